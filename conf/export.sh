@@ -2,11 +2,22 @@
 
 export SVR_BASEPATH=/realtime-chat/api/v1
 export SVR_PORT=:8081
+export REPOSITORY=mongodb
 export DB_DRIVER=mongodb
 export DB_NAME=realtime_chat
 export DB_USER=admin
 export DB_PASSWORD=password 
 export DB_HOST=localhost
 export DB_PORT=27017
+export AUTH_SECRET=change-me
+export AUTH_TOKEN_TTL=24h
+export WS_PING_INTERVAL=30s
+export WS_PONG_WAIT=60s
+export WS_WRITE_TIMEOUT=10s
+export WS_SEND_QUEUE_SIZE=256
+export WS_OVERFLOW_POLICY=disconnect
+export WS_OVERFLOW_TIMEOUT=100ms
+export WS_TYPING_THROTTLE=3s
+export WS_TYPING_TIMEOUT=10s
 
 bin/server
\ No newline at end of file
@@ -7,6 +7,7 @@ require (
 	github.com/gorilla/websocket v1.4.2
 	github.com/rs/zerolog v1.21.0
 	github.com/spf13/viper v1.7.1
+	github.com/swaggo/swag v1.16.4
 	go.mongodb.org/mongo-driver v1.5.1
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/crypto v0.21.0
 )
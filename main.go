@@ -2,11 +2,13 @@ package main
 
 import (
 	"os"
-	
-	"github.com/Tainzen/realtime-chat/src/controller"
-	"github.com/gorilla/mux"
-	
-	"net/http"
+
+	"github.com/Tainzen/realtime-chat/src/hub"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/Tainzen/realtime-chat/src/server"
+	"github.com/Tainzen/realtime-chat/utils/config"
+	"github.com/Tainzen/realtime-chat/utils/database"
+	"github.com/rs/zerolog"
 )
 
 // @title RealTime-Chat Microservice
@@ -14,29 +16,41 @@ import (
 // @description This microservice serves as Realtime chat backend
 
 // @BasePath /realtime-chat/api/v1
-func main() {
-	route := mux.NewRouter()
-
-	// Instantiate controllers
-	realTimeChatController := controller.RealTimeChatController{}
-
-	api := route.PathPrefix("/realtime-chat/api/v1").Subrouter()
-	//chat-rooms apis
-	api.HandleFunc("/", realTimeChatController.HealthCheck).Methods("GET")
-	api.HandleFunc(controller.CreateChatRoomPath, realTimeChatController.CreateChatRoom).Methods("POST")
-	api.HandleFunc(controller.GetAllChatRoomsPath, realTimeChatController.GetAllChatRoom).Methods("GET")
-	api.HandleFunc(controller.GetChatRoomPath, realTimeChatController.GetChatRoom).Methods("GET")
-	api.HandleFunc(controller.UpdateChatRoomPath, realTimeChatController.UpdateChatRoom).Methods("PUT")
-	api.HandleFunc(controller.DeleteChatRoomPath, realTimeChatController.DeleteChatRoom).Methods("DELETE")
-	//users apis
-	api.HandleFunc(controller.CreateUserPath, realTimeChatController.CreateUser).Methods("POST")
-	api.HandleFunc(controller.GetUserPath, realTimeChatController.GetUser).Methods("GET")
-	api.HandleFunc(controller.UpdateUserPath, realTimeChatController.UpdateUser).Methods("PUT")
-	//chat-room-websocker apis
-	api.HandleFunc(controller.ChatRoomWebsocket, realTimeChatController.WebSocketHandler).Methods("GET")
-	
-	http.ListenAndServe(os.Getenv("SVR_PORT"), api)
-}
-
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func main() {
 
+	cfg := config.Load()
+	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	// Instantiate repository, REPOSITORY=memory keeps everything in memory
+	var realTimeChatRepository repository.Repository
+	if cfg.Repository == "memory" {
+		realTimeChatRepository = repository.NewMemoryRepository()
+	} else {
+		client, err := database.Connect(cfg)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Error connecting to mongodb")
+		}
+		logger.Info().Msg("Successfully established connection to mongodb")
+		realTimeChatRepository = repository.NewRealTimeChatRepository(client)
+	}
+
+	realTimeChatHub := hub.NewHub(hub.Config{
+		PingInterval:    cfg.PingInterval,
+		PongWait:        cfg.PongWait,
+		WriteWait:       cfg.WriteTimeout,
+		SendQueueSize:   cfg.SendQueueSize,
+		OverflowPolicy:  hub.OverflowPolicy(cfg.OverflowPolicy),
+		OverflowTimeout: cfg.OverflowTimeout,
+	})
+
+	srv := server.NewServer(cfg, logger, realTimeChatRepository, realTimeChatHub)
+
+	err := srv.ListenAndServe()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Server stopped")
+	}
+}
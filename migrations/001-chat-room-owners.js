@@ -0,0 +1,44 @@
+// Gives an owner to the chat-rooms created before memberships, run it once
+// against the database after deploying memberships:
+//
+//   mongo realtime_chat migrations/001-chat-room-owners.js
+//
+// The first user that posted in a chat-room becomes its owner and the other
+// users that posted in it become members. Chat-rooms nobody posted in are
+// printed, they stay read-only and can not be managed until an owner is
+// assigned by hand. Running it again only touches chat-rooms still without
+// owner.
+
+var owned = db.memberships.distinct("chatroom_id", { role: "owner" });
+
+db.chat_rooms.find({ type: { $ne: "direct" }, _id: { $nin: owned } }).forEach(function (room) {
+
+    // authors of the chat-room, the first one to post first
+    var authors = db.messages.aggregate([
+        { $match: { chatroom_id: room._id } },
+        { $group: { _id: "$user_id", first: { $min: "$_id" } } },
+        { $sort: { first: 1 } }
+    ]).toArray();
+
+    if (authors.length === 0) {
+        print("chat-room " + room._id + " (" + room.name + ") has no messages, assign its owner by hand");
+        return;
+    }
+
+    // the owner replaces any role it had, the others keep theirs
+    db.memberships.updateOne(
+        { chatroom_id: room._id, user_id: authors[0]._id },
+        { $set: { role: "owner" }, $setOnInsert: { joined_at: new Date() } },
+        { upsert: true }
+    );
+
+    authors.slice(1).forEach(function (author) {
+        db.memberships.updateOne(
+            { chatroom_id: room._id, user_id: author._id },
+            { $setOnInsert: { role: "member", joined_at: new Date() } },
+            { upsert: true }
+        );
+    });
+
+    print("chat-room " + room._id + " (" + room.name + ") owned by " + authors[0]._id + " with " + (authors.length - 1) + " other members");
+});
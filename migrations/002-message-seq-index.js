@@ -0,0 +1,15 @@
+// Lets messages be stored before they get their sequence number, run it once
+// against the database:
+//
+//   mongo realtime_chat migrations/002-message-seq-index.js
+//
+// The unique sequence number index only covers the messages that have one.
+// Without it, two messages with a client message id stored at the same time
+// in a chat-room would conflict on their missing sequence number.
+
+db.messages.dropIndex({ chatroom_id: 1, seq: 1 });
+
+db.messages.createIndex(
+    { chatroom_id: 1, seq: 1 },
+    { unique: true, partialFilterExpression: { seq: { $exists: true } } }
+);
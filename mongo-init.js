@@ -4,4 +4,50 @@ db.createUser(
       pwd: "password",
       roles: [ { role: "userAdmin", db: "realtime_chat" }, "readWrite" ]
     }
-);
\ No newline at end of file
+);
+
+// messages are ordered by their per chat-room sequence number, a message with
+// a client message id gets it once stored
+db.messages.createIndex(
+    { chatroom_id: 1, seq: 1 },
+    { unique: true, partialFilterExpression: { seq: { $exists: true } } }
+);
+
+// a message resent with the same client message id is stored only once
+db.messages.createIndex(
+    { chatroom_id: 1, user_id: 1, client_message_id: 1 },
+    { unique: true, partialFilterExpression: { client_message_id: { $exists: true } } }
+);
+
+// replies are paged by thread
+db.messages.createIndex({ parent_id: 1, _id: 1 }, { partialFilterExpression: { parent_id: { $exists: true } } });
+
+// every user has a single read marker per chat-room
+db.read_markers.createIndex({ chatroom_id: 1, user_id: 1 }, { unique: true });
+
+// a pair of users has a single direct chat-room
+db.chat_rooms.createIndex(
+    { direct_key: 1 },
+    { unique: true, partialFilterExpression: { direct_key: { $exists: true } } }
+);
+
+// every user has a single membership per chat-room
+db.memberships.createIndex({ chatroom_id: 1, user_id: 1 }, { unique: true });
+
+// chat-rooms of a user, private chat-rooms are listed to their members
+db.memberships.createIndex({ user_id: 1 });
+
+// a user has at most one pending invitation per chat-room
+db.invitations.createIndex(
+    { chatroom_id: 1, user_id: 1 },
+    { unique: true, partialFilterExpression: { status: "pending" } }
+);
+
+// pending invitations of a user
+db.invitations.createIndex({ user_id: 1, status: 1 });
+
+// invite links are redeemed by code
+db.invite_links.createIndex({ code: 1 }, { unique: true });
+
+// invite links of a chat-room
+db.invite_links.createIndex({ chatroom_id: 1, _id: 1 });
@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"github.com/Tainzen/realtime-chat/src/model"
+	"time"
+)
+
 // SuccessMessage dto
 type HealthCheckResponse struct {
 	Message string `json:"message"`
@@ -34,8 +39,69 @@ type RequestUserUpdate struct {
 	NewPassword string      `json:"newpassword" binding:"required"`
 }
 
-// Message dto
-type Message struct {
-	UserID     string `json:"user_id,omitempty" bson:"user_id,omitempty"`
-	Body       string `json:"body,omitempty" bson:"body,omitempty"`
+// MessagePage dto
+type MessagePage struct {
+	//message starting the thread of a page of replies
+	Parent   *model.Message  `json:"parent,omitempty"`
+	Messages []model.Message `json:"messages"`
+	Before   string          `json:"before,omitempty"`
+	After    string          `json:"after,omitempty"`
+}
+
+// OnlineUsers dto
+type OnlineUsers struct {
+	Users []User `json:"users"`
+}
+
+// EditMessageRequest dto
+type EditMessageRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// DirectChatRoomRequest dto
+type DirectChatRoomRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// MarkReadRequest dto
+type MarkReadRequest struct {
+	MessageID string `json:"message_id"`
+	Seq       int64  `json:"seq"`
+}
+
+// ReadStatus dto
+type ReadStatus struct {
+	ChatRoomID        string `json:"chatroom_id"`
+	LastReadMessageID string `json:"last_read_message_id,omitempty"`
+	LastReadSeq       int64  `json:"last_read_seq"`
+	Unread            int64  `json:"unread"`
+}
+
+// LoginRequest dto
+type LoginRequest struct {
+	UserName string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse dto
+type LoginResponse struct {
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	UserID    interface{} `json:"user_id"`
+}
+
+// MemberRoleRequest dto
+type MemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// InvitationRequest dto
+type InvitationRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// InviteLinkRequest dto
+type InviteLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxUses   int64      `json:"max_uses,omitempty"`
 }
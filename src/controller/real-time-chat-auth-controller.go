@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/Tainzen/realtime-chat/utils/auth"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// contextKey - type of the keys stored by the controller in the request context
+type contextKey string
+
+// userContextKey - request context key of the authenticated user
+const userContextKey contextKey = "user"
+
+// UserFromContext - returns the user authenticated by AuthMiddleware
+func UserFromContext(ctx context.Context) (model.User, bool) {
+	user, ok := ctx.Value(userContextKey).(model.User)
+	return user, ok
+}
+
+// LoginPath - URL Path to log in
+const LoginPath = "/auth/login"
+
+// Login controller
+// @Summary Login API
+// @Description Verifies username and password and issues a bearer token
+// @Param Login body dto.LoginRequest true "Request body username and password"
+// @Produce json
+// @Success 200 {object} dto.LoginResponse "Success"
+// @Failure 401 {object} dto.ErrorMessage "Invalid username or password"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Router /auth/login [post]
+func (realTimeChatController *RealTimeChatController) Login(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.LoginRequest
+	var errMessage dto.ErrorMessage
+
+	// storing request body
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// get user by username
+	user, err := realTimeChatController.repository.FindUserByUsername(req.UserName)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusUnauthorized)
+		errMessage.Message = "Invalid username or password"
+		errMessage.Description = "Invalid username or password, please try again"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting user by username"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//checking if password is correct
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		errMessage.Message = "Invalid username or password"
+		errMessage.Description = "Invalid username or password, please try again"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// issue token
+	token, claims, err := realTimeChatController.tokens.NewToken(user.ID.Hex(), user.UserName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error issuing token"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	response := dto.LoginResponse{
+		Token:     token,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+		UserID:    user.ID,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// AuthMiddleware - rejects requests without a valid bearer token and puts the
+// authenticated user into the request context
+func (realTimeChatController *RealTimeChatController) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var errMessage dto.ErrorMessage
+
+		//get bearer token
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			errMessage.Message = "Missing bearer token"
+			errMessage.Description = "Authorization header with a bearer token is required"
+			json.NewEncoder(w).Encode(errMessage)
+			return
+		}
+
+		user, err := realTimeChatController.authenticate(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			errMessage.Message = "Invalid bearer token"
+			errMessage.Description = err.Error()
+			json.NewEncoder(w).Encode(errMessage)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ChatRoomAccessMiddleware - rejects the requests of the authenticated user to a
+// {room_id} chat room the user can not access, it must run after AuthMiddleware.
+// Missing chat rooms are left to the handlers.
+func (realTimeChatController *RealTimeChatController) ChatRoomAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var errMessage dto.ErrorMessage
+
+		roomid, err := primitive.ObjectIDFromHex(mux.Vars(r)["room_id"])
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		room, err := realTimeChatController.repository.FindChatRoomByID(roomid)
+		if err == repository.ErrNotFound {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			errMessage.Message = "Error getting chat-room"
+			errMessage.Description = err.Error()
+			json.NewEncoder(w).Encode(errMessage)
+			return
+		}
+
+		user, _ := UserFromContext(r.Context())
+		access, err := realTimeChatController.chatRoomAccess(room, user)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			errMessage.Message = "Error getting membership"
+			errMessage.Description = err.Error()
+			json.NewEncoder(w).Encode(errMessage)
+			return
+		}
+		if !access {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			errMessage.Message = "Chat-room access denied"
+			errMessage.Description = "Only the members of the chat-room can access it"
+			json.NewEncoder(w).Encode(errMessage)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canAccessChatRoom - direct chat rooms can only be accessed by their two
+// members, the other chat rooms by everyone
+func canAccessChatRoom(room model.ChatRoom, user model.User) bool {
+
+	if room.Type != model.ChatRoomTypeDirect {
+		return true
+	}
+
+	for _, member := range room.Members {
+		if member == user.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chatRoomAccess - private chat rooms can only be accessed by their members,
+// the other chat rooms as told by canAccessChatRoom
+func (realTimeChatController *RealTimeChatController) chatRoomAccess(room model.ChatRoom, user model.User) (bool, error) {
+
+	if !canAccessChatRoom(room, user) {
+		return false, nil
+	}
+
+	if room.Visibility != model.ChatRoomPrivate {
+		return true, nil
+	}
+
+	role, err := realTimeChatController.memberRole(room.ID, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return role != "", nil
+}
+
+// bearerSubprotocol - websocket subprotocol announcing that the next offered
+// subprotocol is a bearer token
+const bearerSubprotocol = "bearer"
+
+// websocketToken - returns the bearer token of a websocket upgrade request from
+// the Authorization header, the token query parameter or the subprotocols
+func websocketToken(r *http.Request) string {
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i < len(protocols)-1; i++ {
+		if protocols[i] == bearerSubprotocol {
+			return protocols[i+1]
+		}
+	}
+
+	return ""
+}
+
+// authenticate - verifies the token and returns the user it was issued to
+func (realTimeChatController *RealTimeChatController) authenticate(token string) (model.User, error) {
+
+	var user model.User
+
+	claims, err := realTimeChatController.tokens.ParseToken(token)
+	if err != nil {
+		return user, err
+	}
+
+	uid, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return user, auth.ErrInvalidToken
+	}
+
+	// the user may have been removed since the token was issued
+	user, err = realTimeChatController.repository.FindUserByID(uid)
+	if err != nil {
+		return user, err
+	}
+
+	//never keep the password hash around
+	user.Password = ""
+
+	return user, nil
+}
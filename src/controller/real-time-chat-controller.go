@@ -3,36 +3,60 @@ package controller
 import (
 	"encoding/json"
 	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/hub"
 	"github.com/Tainzen/realtime-chat/src/model"
 	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/Tainzen/realtime-chat/utils/auth"
+	"github.com/Tainzen/realtime-chat/utils/config"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-//RoomMap
-var RoomMap = make(map[string]Room)
-
-//Room to keep connections and broadcast message
-type Room struct {
-	Clients   map[*websocket.Conn]bool
-	Broadcast chan dto.Message
+// RealTimeChatController - Structure
+type RealTimeChatController struct {
+	//repository to save chat rooms, users and messages
+	repository repository.Repository
+	//hub keeps the connections of every chat room
+	hub *hub.Hub
+	//tokens issues and verifies the bearer tokens
+	tokens *auth.Tokens
+	//upgrader, it is shared by every request so it must not be modified by handlers
+	upgrader websocket.Upgrader
+	logger   zerolog.Logger
+	//throttle and expiry of the typing indicators
+	typingThrottle time.Duration
+	typingTimeout  time.Duration
 }
 
-//upgrader
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+// NewRealTimeChatController - returns a controller using the given dependencies
+func NewRealTimeChatController(cfg config.Config, logger zerolog.Logger, repository repository.Repository, realTimeChatHub *hub.Hub) *RealTimeChatController {
+	return &RealTimeChatController{
+		repository: repository,
+		hub:        realTimeChatHub,
+		tokens:     auth.NewTokens(cfg.AuthSecret, cfg.TokenTTL),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			//resolve origin
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+			//browsers can not set headers on websockets, they send the token as
+			//the "bearer, <token>" subprotocols
+			Subprotocols: []string{bearerSubprotocol},
+		},
+		logger:         logger,
+		typingThrottle: cfg.TypingThrottle,
+		typingTimeout:  cfg.TypingTimeout,
+	}
 }
 
-//realTimeChatRepository to save into monogdb
-var realTimeChatRepository = repository.RealTimeChatRepository{}
-
-// RealTimeChatController - Structure
-type RealTimeChatController struct{}
-
 // HealthCheckPath - URL Path for health check
 const HealthCheckPath = "/"
 
@@ -55,16 +79,36 @@ func (realTimeChatController *RealTimeChatController) HealthCheck(w http.Respons
 	json.NewEncoder(w).Encode(response)
 }
 
+// MetricsPath - URL Path for the websocket metrics
+const MetricsPath = "/metrics"
+
+// Metrics Controller
+// @Summary Websocket metrics API
+// @Description Number of active rooms and clients and of stale clients reaped since start
+// @Produce json
+// @Success 200 {object} hub.Stats "Success"
+// @Router /metrics [get]
+func (realTimeChatController *RealTimeChatController) Metrics(w http.ResponseWriter, r *http.Request) {
+
+	//adding Content-type
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(realTimeChatController.hub.Stats())
+}
+
 // CreateChatRoomPath - URL Path to create chat room
 const CreateChatRoomPath = "/chat-rooms"
 
 // CreateChatRoom controller
 // @Summary Create new chat room API
-// @Description Create new chat room and saves in mongo db
+// @Description Create new chat room and saves in mongo db, the authenticated user becomes its owner.
+// @Description Private chat rooms are only listed to their members and can only be joined by invitation.
 // @Param ChatRoom body model.ChatRoom true "Request body Chat Room details"
 // @Produce json
 // @Success 200 {object} dto.SuccessMessage "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
 // @Router /chat-rooms [post]
 func (realTimeChatController *RealTimeChatController) CreateChatRoom(w http.ResponseWriter, r *http.Request) {
 
@@ -74,6 +118,8 @@ func (realTimeChatController *RealTimeChatController) CreateChatRoom(w http.Resp
 	var chatRoom model.ChatRoom
 	var errMessage dto.ErrorMessage
 
+	user, _ := UserFromContext(r.Context())
+
 	// storing chatRoom
 	err := json.NewDecoder(r.Body).Decode(&chatRoom)
 	if err != nil {
@@ -84,8 +130,24 @@ func (realTimeChatController *RealTimeChatController) CreateChatRoom(w http.Resp
 		return
 	}
 
+	//direct chat rooms are only created through CreateDirectChatRoom
+	chatRoom.Type = ""
+	chatRoom.Members = nil
+
+	switch chatRoom.Visibility {
+	case "":
+		chatRoom.Visibility = model.ChatRoomPublic
+	case model.ChatRoomPublic, model.ChatRoomPrivate:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid visibility"
+		errMessage.Description = "visibility must be public or private"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
 	//check if chat-room already exists
-	count, err := realTimeChatRepository.CountChatRoomByChatName(chatRoom.Name)
+	count, err := realTimeChatController.repository.CountChatRoomByChatName(chatRoom.Name)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error counting chat-room"
@@ -104,7 +166,7 @@ func (realTimeChatController *RealTimeChatController) CreateChatRoom(w http.Resp
 	}
 
 	// create chat room
-	result, err := realTimeChatRepository.CreateChatRoom(chatRoom)
+	result, err := realTimeChatController.repository.CreateChatRoom(chatRoom)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error creating chat-room"
@@ -113,6 +175,23 @@ func (realTimeChatController *RealTimeChatController) CreateChatRoom(w http.Resp
 		return
 	}
 
+	//the creator owns the chat room
+	_, err = realTimeChatController.repository.AddMember(model.Membership{
+		ChatRoomID: result,
+		UserID:     user.ID,
+		Role:       model.RoleOwner,
+	})
+	if err != nil {
+		//a chat room without owner could not be managed
+		realTimeChatController.repository.DeleteChatRoom(result)
+
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error adding chat-room owner"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
 	// response message body
 	response := dto.SuccessMessage{
 		Message: "Chat room created successfully!",
@@ -127,10 +206,11 @@ const GetAllChatRoomsPath = "/chat-rooms"
 
 // GetAllChatRoom controller
 // @Summary Get all chat rooms API
-// @Description Get all chat room
+// @Description Get all public chat rooms and the private and direct chat rooms of the authenticated user
 // @Produce json
 // @Success 200 {object} []model.ChatRoom "Success"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
 // @Router /chat-rooms [get]
 func (realTimeChatController *RealTimeChatController) GetAllChatRoom(w http.ResponseWriter, r *http.Request) {
 
@@ -138,8 +218,10 @@ func (realTimeChatController *RealTimeChatController) GetAllChatRoom(w http.Resp
 
 	var errMessage dto.ErrorMessage
 
+	user, _ := UserFromContext(r.Context())
+
 	// get chat-room by id
-	result, err := realTimeChatRepository.FindAllChatRooms()
+	result, err := realTimeChatController.repository.FindAllChatRooms(user.ID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error creating chat-room"
@@ -148,7 +230,16 @@ func (realTimeChatController *RealTimeChatController) GetAllChatRoom(w http.Resp
 		return
 	}
 
-	json.NewEncoder(w).Encode(result)
+	//private chat rooms of other users are already left out, only list
+	//the direct chat rooms of the user
+	chatRooms := []model.ChatRoom{}
+	for _, chatRoom := range result {
+		if canAccessChatRoom(chatRoom, user) {
+			chatRooms = append(chatRooms, chatRoom)
+		}
+	}
+
+	json.NewEncoder(w).Encode(chatRooms)
 }
 
 // GetChatRoomPath - URL Path to get chat room by id
@@ -161,7 +252,8 @@ const GetChatRoomPath = "/chat-rooms/{room_id}"
 // @Produce json
 // @Success 200 {object} model.ChatRoom "Success"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
-// @Router /chat-rooms [get]
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id} [get]
 func (realTimeChatController *RealTimeChatController) GetChatRoom(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -180,7 +272,7 @@ func (realTimeChatController *RealTimeChatController) GetChatRoom(w http.Respons
 	}
 
 	// get chat room by id
-	result, err := realTimeChatRepository.FindChatRoomByID(roomid)
+	result, err := realTimeChatController.repository.FindChatRoomByID(roomid)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error getting chat-room by id"
@@ -202,8 +294,10 @@ const UpdateChatRoomPath = "/chat-rooms/{room_id}"
 // @Param ChatRoom body model.ChatRoom true "Request body Chat Room details"
 // @Produce json
 // @Success 200 {object} dto.SuccessMessage "Success"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
-// @Router /chat-rooms [put]
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id} [put]
 func (realTimeChatController *RealTimeChatController) UpdateChatRoom(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -211,6 +305,8 @@ func (realTimeChatController *RealTimeChatController) UpdateChatRoom(w http.Resp
 	var chatRoom model.ChatRoom
 	var errMessage dto.ErrorMessage
 
+	user, _ := UserFromContext(r.Context())
+
 	//get paramaters
 	param := mux.Vars(r)["room_id"]
 	roomid, err := primitive.ObjectIDFromHex(param)
@@ -222,7 +318,22 @@ func (realTimeChatController *RealTimeChatController) UpdateChatRoom(w http.Resp
 		return
 	}
 
-	chatRoom.ID = roomid
+	//only owners and admins can rename the chat room
+	manage, err := realTimeChatController.canManageChatRoom(roomid, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if !manage {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to rename the chat-room"
+		errMessage.Description = "Only the owner and the admins of the chat-room can rename it"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
 
 	// storing chatRoom
 	err = json.NewDecoder(r.Body).Decode(&chatRoom)
@@ -234,8 +345,11 @@ func (realTimeChatController *RealTimeChatController) UpdateChatRoom(w http.Resp
 		return
 	}
 
+	//the path decides which chat room is renamed, not an id in the body
+	chatRoom.ID = roomid
+
 	// update chat room
-	_, err = realTimeChatRepository.UpdateChatRoom(chatRoom)
+	_, err = realTimeChatController.repository.UpdateChatRoom(chatRoom)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error creating chat-room"
@@ -262,14 +376,18 @@ const DeleteChatRoomPath = "/chat-rooms/{room_id}"
 // @Param roomid path string true "room id"
 // @Produce json
 // @Success 200 {object} dto.SuccessMessage "Success"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
-// @Router /chat-rooms [delete]
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id} [delete]
 func (realTimeChatController *RealTimeChatController) DeleteChatRoom(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
 	var errMessage dto.ErrorMessage
 
+	user, _ := UserFromContext(r.Context())
+
 	//get paramaters
 	param := mux.Vars(r)["room_id"]
 	roomid, err := primitive.ObjectIDFromHex(param)
@@ -281,8 +399,25 @@ func (realTimeChatController *RealTimeChatController) DeleteChatRoom(w http.Resp
 		return
 	}
 
-	// update chat room
-	_, err = realTimeChatRepository.DeleteChatRoom(roomid)
+	//only owners and admins can delete the chat room
+	manage, err := realTimeChatController.canManageChatRoom(roomid, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if !manage {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to delete the chat-room"
+		errMessage.Description = "Only the owner and the admins of the chat-room can delete it"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// delete chat room
+	_, err = realTimeChatController.repository.DeleteChatRoom(roomid)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error deleteing chat-room"
@@ -300,6 +435,296 @@ func (realTimeChatController *RealTimeChatController) DeleteChatRoom(w http.Resp
 
 }
 
+// GetChatRoomMessagesPath - URL Path to get the message history of a chat room
+const GetChatRoomMessagesPath = "/chat-rooms/{room_id}/messages"
+
+// defaultMessagesLimit - page size when no limit is requested
+const defaultMessagesLimit = 50
+
+// maxMessagesLimit - biggest page size that can be requested
+const maxMessagesLimit = 100
+
+// GetChatRoomMessages controller
+// @Summary Get chat room messages API
+// @Description Get the messages of a chat room newest first, use the before cursor to page back and the after cursor to page forward
+// @Param roomid path string true "room id"
+// @Param before query string false "only messages older than this message id"
+// @Param after query string false "only messages newer than this message id"
+// @Param limit query int false "page size, defaults to 50 and can be at most 100"
+// @Produce json
+// @Success 200 {object} dto.MessagePage "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/messages [get]
+func (realTimeChatController *RealTimeChatController) GetChatRoomMessages(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get cursors and page size
+	before, after, limit, ok := messagePageParams(r, &errMessage)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	_, err = realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room by id"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// get messages of chat room
+	messages, err := realTimeChatController.repository.FindMessagesByChatRoomID(roomid, before, after, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting messages of chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(messagePage(messages))
+}
+
+// messagePageParams reads the before and after cursors and the page size of a
+// message page request, errMessage is filled when they are invalid
+func messagePageParams(r *http.Request, errMessage *dto.ErrorMessage) (primitive.ObjectID, primitive.ObjectID, int64, bool) {
+
+	var err error
+
+	//get cursors
+	query := r.URL.Query()
+	var before, after primitive.ObjectID
+	if value := query.Get("before"); value != "" {
+		before, err = primitive.ObjectIDFromHex(value)
+		if err != nil {
+			errMessage.Message = "Invalid before cursor"
+			errMessage.Description = err.Error()
+			return before, after, 0, false
+		}
+	}
+	if value := query.Get("after"); value != "" {
+		after, err = primitive.ObjectIDFromHex(value)
+		if err != nil {
+			errMessage.Message = "Invalid after cursor"
+			errMessage.Description = err.Error()
+			return before, after, 0, false
+		}
+	}
+
+	//get page size
+	limit := int64(defaultMessagesLimit)
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxMessagesLimit {
+			errMessage.Message = "Invalid limit"
+			errMessage.Description = "Limit must be a number between 1 and " + strconv.Itoa(maxMessagesLimit)
+			return before, after, 0, false
+		}
+	}
+
+	return before, after, limit, true
+}
+
+// messagePage builds the page of messages with the cursors to load the
+// previous and next pages
+func messagePage(messages []model.Message) dto.MessagePage {
+
+	page := dto.MessagePage{
+		Messages: messages,
+	}
+
+	if len(messages) != 0 {
+		page.Before = messages[len(messages)-1].ID.Hex()
+		page.After = messages[0].ID.Hex()
+	}
+
+	return page
+}
+
+// GetMessageRepliesPath - URL Path to get the thread of a message
+const GetMessageRepliesPath = "/chat-rooms/{room_id}/messages/{message_id}/replies"
+
+// GetMessageReplies controller
+// @Summary Get message replies API
+// @Description Get the message starting a thread and a page of its replies newest first, use the before cursor to page back and the after cursor to page forward
+// @Param roomid path string true "room id"
+// @Param messageid path string true "message id"
+// @Param before query string false "only replies older than this message id"
+// @Param after query string false "only replies newer than this message id"
+// @Param limit query int false "page size, defaults to 50 and can be at most 100"
+// @Produce json
+// @Success 200 {object} dto.MessagePage "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 404 {object} dto.ErrorMessage "Message not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/messages/{message_id}/replies [get]
+func (realTimeChatController *RealTimeChatController) GetMessageReplies(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get cursors and page size
+	before, after, limit, ok := messagePageParams(r, &errMessage)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get the message starting the thread
+	parent, err := realTimeChatController.findRoomMessage(roomid, mux.Vars(r)["message_id"], 0)
+	if err == errMessageNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Message not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// get replies of message
+	replies, err := realTimeChatController.repository.FindReplies(parent.ID, before, after, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting replies of message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	response := messagePage(replies)
+	response.Parent = &parent
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetChatRoomOnlinePath - URL Path to get the users connected to a chat room
+const GetChatRoomOnlinePath = "/chat-rooms/{room_id}/online"
+
+// GetChatRoomOnline controller
+// @Summary Get chat room online users API
+// @Description Get the users with at least one websocket connected to the chat room
+// @Param roomid path string true "room id"
+// @Produce json
+// @Success 200 {object} dto.OnlineUsers "Success"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/online [get]
+func (realTimeChatController *RealTimeChatController) GetChatRoomOnline(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	_, err = realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//online users are looked up at once, the hub only knows their ids
+	online := realTimeChatController.hub.Online(roomid.Hex())
+	uids := make([]primitive.ObjectID, 0, len(online))
+	for _, id := range online {
+		uid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		uids = append(uids, uid)
+	}
+
+	users, err := realTimeChatController.repository.FindUsersByIDs(uids)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting online users"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	response := dto.OnlineUsers{Users: []dto.User{}}
+	for _, result := range users {
+		response.Users = append(response.Users, dto.User{
+			ID:        result.ID,
+			UserName:  result.UserName,
+			FirstName: result.FirstName,
+			Lastname:  result.LastName,
+		})
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
 // CreateUserPath - URL Path to create user
 const CreateUserPath = "/users"
 
@@ -331,7 +756,7 @@ func (realTimeChatController *RealTimeChatController) CreateUser(w http.Response
 	}
 
 	//check if username already exists
-	count, err := realTimeChatRepository.CountUserByUsername(user.UserName)
+	count, err := realTimeChatController.repository.CountUserByUsername(user.UserName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error counting user by username"
@@ -363,7 +788,7 @@ func (realTimeChatController *RealTimeChatController) CreateUser(w http.Response
 	user.Password = string(hashBytes)
 
 	//create user
-	result, err := realTimeChatRepository.CreateUser(user)
+	result, err := realTimeChatController.repository.CreateUser(user)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error creating user"
@@ -391,7 +816,8 @@ const GetUserPath = "/users/{uid}"
 // @Produce json
 // @Success 200 {object} dto.User "Success"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
-// @Router /users [get]
+// @Security BearerAuth
+// @Router /users/{uid} [get]
 func (realTimeChatController *RealTimeChatController) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -410,7 +836,7 @@ func (realTimeChatController *RealTimeChatController) GetUser(w http.ResponseWri
 	}
 
 	// get user by id
-	result, err := realTimeChatRepository.FindUserByID(uid)
+	result, err := realTimeChatController.repository.FindUserByID(uid)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error getting user by id"
@@ -440,7 +866,9 @@ const UpdateUserPath = "/users/{uid}"
 // @Produce json
 // @Success 200 {object} dto.SuccessMessage "Success"
 // @Failure 401 {object} dto.ErrorMessage "Wrong Password"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
 // @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
 // @Router /users/{uid} [put]
 func (realTimeChatController *RealTimeChatController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
@@ -460,6 +888,15 @@ func (realTimeChatController *RealTimeChatController) UpdateUser(w http.Response
 		return
 	}
 
+	//users can only update themselves
+	if user, _ := UserFromContext(r.Context()); user.ID != uid {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Forbidden"
+		errMessage.Description = "Users can only update their own details"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
 	// storing request user body
 	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -471,7 +908,7 @@ func (realTimeChatController *RealTimeChatController) UpdateUser(w http.Response
 	}
 
 	// get user by id
-	result, err := realTimeChatRepository.FindUserByID(uid)
+	result, err := realTimeChatController.repository.FindUserByID(uid)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error getting user by id"
@@ -508,7 +945,7 @@ func (realTimeChatController *RealTimeChatController) UpdateUser(w http.Response
 	}
 
 	// update user
-	_, err = realTimeChatRepository.UpdateUser(user)
+	_, err = realTimeChatController.repository.UpdateUser(user)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		errMessage.Message = "Error creating chat-room"
@@ -525,160 +962,3 @@ func (realTimeChatController *RealTimeChatController) UpdateUser(w http.Response
 	json.NewEncoder(w).Encode(response)
 
 }
-
-// handleConnections handles all the connection on websockets
-func handleConnections(ws *websocket.Conn, roomid string) (Room, error) {
-
-	var room Room
-
-	value, _ := RoomMap[roomid]
-
-	room = value
-
-	// Register our new client
-	room.Clients[ws] = true
-
-	for {
-		var msg dto.Message
-
-		// Read in a new message as JSON and map it to a Message object
-		err := ws.ReadJSON(&msg)
-		if err != nil {
-			delete(room.Clients, ws)
-			break
-		}
-		//save message in db
-		rid, err := primitive.ObjectIDFromHex(roomid)
-		if err != nil {
-			return room, err
-		}
-
-		uid, err := primitive.ObjectIDFromHex(msg.UserID)
-		if err != nil {
-			return room, err
-		}
-
-		m := model.Message{
-			UserID:     uid,
-			ChatRoomID: rid,
-			Body:       msg.Body,
-		}
-
-		// get user by id
-		_, err = realTimeChatRepository.FindUserByID(uid)
-		if err != nil {
-			return room, err
-		}
-
-		//create message
-		_, err = realTimeChatRepository.CreateMessage(m)
-		if err != nil {
-			return room, err
-		}
-
-		// Send the newly received message to the broadcast channel
-		room.Broadcast <- msg
-
-	}
-
-	return room, nil
-
-}
-
-//handleMessages function that writes into connection
-func handleMessages(room Room) {
-
-	for {
-		// Grab the next message from the broadcast channel
-		msg := <-room.Broadcast
-		// Send it out to every client that is currently connected
-		for client := range room.Clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				client.Close()
-				delete(room.Clients, client)
-			}
-		}
-	}
-
-}
-
-const ChatRoomWebsocket = "/ws/chat-room/{room_id}"
-
-// WebSocketHandler controller
-// @Summary Websocket handler API
-// @Description Websocket handler api to initiate websockets
-// @Param roomid path string true "room id"
-// @Param User body dto.Message true "Request body user id and message body"
-// @Produce json
-// @Success 200 {object} dto.SuccessMessage "Success"
-// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
-// @Router /ws/chat-room/{room_id} [get]
-func (realTimeChatController *RealTimeChatController) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-
-	var errMessage dto.ErrorMessage
-
-	//get paramaters
-	rid := mux.Vars(r)["room_id"]
-	roomid, err := primitive.ObjectIDFromHex(rid)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		errMessage.Message = "Error while converting roomid to ObjectID"
-		errMessage.Description = err.Error()
-		json.NewEncoder(w).Encode(errMessage)
-		return
-	}
-
-	//get chat room by id to check if room id is present or not
-	_, err = realTimeChatRepository.FindChatRoomByID(roomid)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		errMessage.Message = "Error getting chat-room"
-		errMessage.Description = err.Error()
-		json.NewEncoder(w).Encode(errMessage)
-		return
-	}
-
-	//resolve origin
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
-	}
-
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		errMessage.Message = "Error while upgrading http connection to websockets"
-		errMessage.Description = err.Error()
-		json.NewEncoder(w).Encode(errMessage)
-		return
-	}
-
-	defer conn.Close()
-
-	//initailizing room
-	var room Room
-	_, ok := RoomMap[rid]
-
-	room.Clients = map[*websocket.Conn]bool{}
-	room.Broadcast = nil
-
-	//register connection
-	if ok == false {
-		RoomMap[rid] = room
-	}
-
-	//handle connection
-	cr, err := handleConnections(conn, rid)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		errMessage.Message = "Error broadcasting message"
-		errMessage.Description = err.Error()
-		json.NewEncoder(w).Encode(errMessage)
-		return
-	}
-
-	RoomMap[rid] = cr
-
-	go handleMessages(cr)
-
-}
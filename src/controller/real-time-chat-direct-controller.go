@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// CreateDirectChatRoomPath - URL Path to get or create a direct chat room
+const CreateDirectChatRoomPath = "/direct-messages"
+
+// CreateDirectChatRoom controller
+// @Summary Get or create direct chat room API
+// @Description Returns the direct chat room of the authenticated user and the given user, creating it on the first call.
+// @Description Only its two members can access it, messages are sent through the chat room websocket as usual.
+// @Param DirectChatRoom body dto.DirectChatRoomRequest true "id of the other user"
+// @Produce json
+// @Success 200 {object} model.ChatRoom "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 404 {object} dto.ErrorMessage "User not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /direct-messages [post]
+func (realTimeChatController *RealTimeChatController) CreateDirectChatRoom(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.DirectChatRoomRequest
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	// storing request body
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	uid, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid user id"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if uid == user.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid user id"
+		errMessage.Description = "Direct chat-rooms are between two different users"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//check if the other user exists
+	_, err = realTimeChatController.repository.FindUserByID(uid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "User not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting user by id"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// get or create direct chat room
+	result, err := realTimeChatController.repository.FindOrCreateDirectChatRoom(user.ID, uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error creating direct chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// CreateInvitationPath - URL Path to invite a user to a chat room
+const CreateInvitationPath = "/chat-rooms/{room_id}/invitations"
+
+// CreateInvitation controller
+// @Summary Invite user to chat room API
+// @Description Invites a user to join the chat room, only the owner and the admins can invite. Inviting a user again returns the pending invitation.
+// @Param roomid path string true "room id"
+// @Param Invitation body dto.InvitationRequest true "id of the invited user"
+// @Produce json
+// @Success 200 {object} model.Invitation "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room or user not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/invitations [post]
+func (realTimeChatController *RealTimeChatController) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.InvitationRequest
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// storing request body
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	uid, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid user id"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	room, err := realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//only owners and admins can invite to the chat room
+	manage, err := realTimeChatController.canManageChatRoom(roomid, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if room.Type == model.ChatRoomTypeDirect || !manage {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to invite to the chat-room"
+		errMessage.Description = "Only the owner and the admins of the chat-room can invite to it"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//check if the invited user exists
+	_, err = realTimeChatController.repository.FindUserByID(uid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "User not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting user by id"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	role, err := realTimeChatController.memberRole(roomid, uid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if role != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Already a member"
+		errMessage.Description = "The user is already a member of the chat-room"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// create invitation, a user invited again gets the pending invitation
+	result, err := realTimeChatController.repository.CreateInvitation(model.Invitation{
+		ChatRoomID: roomid,
+		UserID:     uid,
+		InvitedBy:  user.ID,
+	})
+	if err != nil && err != repository.ErrAlreadyInvited {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error creating invitation"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetInvitationsPath - URL Path to get the pending invitations of the user
+const GetInvitationsPath = "/invitations"
+
+// GetInvitations controller
+// @Summary Get invitations API
+// @Description Get the pending invitations of the authenticated user oldest first
+// @Produce json
+// @Success 200 {object} []model.Invitation "Success"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /invitations [get]
+func (realTimeChatController *RealTimeChatController) GetInvitations(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	result, err := realTimeChatController.repository.FindPendingInvitations(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting invitations"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// AcceptInvitationPath - URL Path to accept an invitation
+const AcceptInvitationPath = "/invitations/{invitation_id}/accept"
+
+// AcceptInvitation controller
+// @Summary Accept invitation API
+// @Description Accepts a pending invitation of the authenticated user and joins the chat room as member
+// @Param invitationid path string true "invitation id"
+// @Produce json
+// @Success 200 {object} model.Invitation "Success"
+// @Failure 404 {object} dto.ErrorMessage "Invitation not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /invitations/{invitation_id}/accept [post]
+func (realTimeChatController *RealTimeChatController) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	realTimeChatController.respondInvitation(w, r, model.InvitationAccepted)
+}
+
+// DeclineInvitationPath - URL Path to decline an invitation
+const DeclineInvitationPath = "/invitations/{invitation_id}/decline"
+
+// DeclineInvitation controller
+// @Summary Decline invitation API
+// @Description Declines a pending invitation of the authenticated user
+// @Param invitationid path string true "invitation id"
+// @Produce json
+// @Success 200 {object} model.Invitation "Success"
+// @Failure 404 {object} dto.ErrorMessage "Invitation not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /invitations/{invitation_id}/decline [post]
+func (realTimeChatController *RealTimeChatController) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	realTimeChatController.respondInvitation(w, r, model.InvitationDeclined)
+}
+
+// respondInvitation answers a pending invitation of the user with the status,
+// accepting it makes the user a member of the chat room
+func (realTimeChatController *RealTimeChatController) respondInvitation(w http.ResponseWriter, r *http.Request, status string) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["invitation_id"]
+	id, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting invitationid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//the invitations of other users are not disclosed
+	invitation, err := realTimeChatController.repository.FindInvitationByID(id)
+	if err == repository.ErrNotFound || (err == nil && (invitation.UserID != user.ID || invitation.Status != model.InvitationPending)) {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Invitation not found"
+		errMessage.Description = "No pending invitation with this id"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting invitation"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//the invitation may have been answered meanwhile
+	result, err := realTimeChatController.repository.RespondInvitation(id, status)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Invitation not found"
+		errMessage.Description = "No pending invitation with this id"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error answering invitation"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if status == model.InvitationAccepted {
+		_, err = realTimeChatController.repository.AddMember(model.Membership{
+			ChatRoomID: result.ChatRoomID,
+			UserID:     user.ID,
+			Role:       model.RoleMember,
+		})
+		if err != nil && err != repository.ErrAlreadyMember {
+			w.WriteHeader(http.StatusInternalServerError)
+			errMessage.Message = "Error joining chat-room"
+			errMessage.Description = err.Error()
+			json.NewEncoder(w).Encode(errMessage)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"net/http"
+	"time"
+)
+
+// inviteCodeSize - random bytes of an invite code, base64 encoded in the link
+const inviteCodeSize = 12
+
+// CreateInviteLinkPath - URL Path to create an invite link of a chat room
+const CreateInviteLinkPath = "/chat-rooms/{room_id}/invites"
+
+// CreateInviteLink controller
+// @Summary Create invite link API
+// @Description Creates a shareable code joining the chat room, optionally expiring at expires_at or after max_uses redemptions. Only the owner and the admins can create invite links.
+// @Param roomid path string true "room id"
+// @Param InviteLink body dto.InviteLinkRequest false "expiry and maximum number of uses"
+// @Produce json
+// @Success 200 {object} model.InviteLink "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/invites [post]
+func (realTimeChatController *RealTimeChatController) CreateInviteLink(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.InviteLinkRequest
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// storing request body, an empty body creates an invite link without limits
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid expiry"
+		errMessage.Description = "expires_at must be in the future"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if req.MaxUses < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid maximum number of uses"
+		errMessage.Description = "max_uses must be positive, or 0 for no limit"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if !realTimeChatController.manageInviteLinks(w, roomid, user, &errMessage) {
+		return
+	}
+
+	code, err := inviteCode()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error generating invite code"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	link := model.InviteLink{
+		ChatRoomID: roomid,
+		Code:       code,
+		CreatedBy:  user.ID,
+		MaxUses:    req.MaxUses,
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		link.ExpiresAt = &expiresAt
+	}
+
+	// create invite link
+	result, err := realTimeChatController.repository.CreateInviteLink(link)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error creating invite link"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetInviteLinksPath - URL Path to get the active invite links of a chat room
+const GetInviteLinksPath = "/chat-rooms/{room_id}/invites"
+
+// GetInviteLinks controller
+// @Summary Get invite links API
+// @Description Get the invite links of the chat room that are not expired, used up or revoked. Only the owner and the admins can see them.
+// @Param roomid path string true "room id"
+// @Produce json
+// @Success 200 {object} []model.InviteLink "Success"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/invites [get]
+func (realTimeChatController *RealTimeChatController) GetInviteLinks(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if !realTimeChatController.manageInviteLinks(w, roomid, user, &errMessage) {
+		return
+	}
+
+	result, err := realTimeChatController.repository.FindActiveInviteLinks(roomid, time.Now().UTC())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting invite links"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// RevokeInviteLinkPath - URL Path to revoke an invite link of a chat room
+const RevokeInviteLinkPath = "/chat-rooms/{room_id}/invites/{code}"
+
+// RevokeInviteLink controller
+// @Summary Revoke invite link API
+// @Description Revokes an invite link of the chat room, it can not be redeemed anymore. Only the owner and the admins can revoke invite links.
+// @Param roomid path string true "room id"
+// @Param code path string true "invite code"
+// @Produce json
+// @Success 200 {object} model.InviteLink "Success"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Invite link not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/invites/{code} [delete]
+func (realTimeChatController *RealTimeChatController) RevokeInviteLink(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	vars := mux.Vars(r)
+	roomid, err := primitive.ObjectIDFromHex(vars["room_id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if !realTimeChatController.manageInviteLinks(w, roomid, user, &errMessage) {
+		return
+	}
+
+	// revoke invite link
+	result, err := realTimeChatController.repository.RevokeInviteLink(roomid, vars["code"])
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Invite link not found"
+		errMessage.Description = "No invite link of the chat-room with this code, or it is already revoked"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error revoking invite link"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// RedeemInviteLinkPath - URL Path to join a chat room with an invite code
+const RedeemInviteLinkPath = "/invites/{code}/redeem"
+
+// RedeemInviteLink controller
+// @Summary Redeem invite link API
+// @Description Joins the chat room of the invite code as member, private chat rooms included. Members redeeming the code again get their membership without using the code.
+// @Param code path string true "invite code"
+// @Produce json
+// @Success 200 {object} model.Membership "Success"
+// @Failure 404 {object} dto.ErrorMessage "Invite link not found"
+// @Failure 410 {object} dto.ErrorMessage "Invite link expired, used up or revoked"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /invites/{code}/redeem [post]
+func (realTimeChatController *RealTimeChatController) RedeemInviteLink(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	code := mux.Vars(r)["code"]
+
+	link, err := realTimeChatController.repository.FindInviteLinkByCode(code)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Invite link not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting invite link"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//members do not use up the code
+	membership, err := realTimeChatController.repository.FindMember(link.ChatRoomID, user.ID)
+	if err == nil {
+		json.NewEncoder(w).Encode(membership)
+		return
+	}
+	if err != repository.ErrNotFound {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//the link may have expired, been used up or revoked, even meanwhile
+	_, err = realTimeChatController.repository.UseInviteLink(code, time.Now().UTC())
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusGone)
+		errMessage.Message = "Invite link is no longer valid"
+		errMessage.Description = "The invite link expired, was used up or was revoked"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error redeeming invite link"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// add member, joined meanwhile returns the current membership
+	result, err := realTimeChatController.repository.AddMember(model.Membership{
+		ChatRoomID: link.ChatRoomID,
+		UserID:     user.ID,
+		Role:       model.RoleMember,
+	})
+	if err != nil && err != repository.ErrAlreadyMember {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error joining chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// manageInviteLinks checks that the room exists, is not a direct room and that
+// the user is its owner or one of its admins, otherwise writes the error response
+// and returns false
+func (realTimeChatController *RealTimeChatController) manageInviteLinks(w http.ResponseWriter, roomid primitive.ObjectID, user model.User, errMessage *dto.ErrorMessage) bool {
+
+	//get chat room by id to check if room id is present or not
+	room, err := realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return false
+	}
+
+	manage, err := realTimeChatController.canManageChatRoom(roomid, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return false
+	}
+
+	if room.Type == model.ChatRoomTypeDirect || !manage {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to manage invite links"
+		errMessage.Description = "Only the owner and the admins of the chat-room can manage its invite links"
+		json.NewEncoder(w).Encode(errMessage)
+		return false
+	}
+
+	return true
+}
+
+// inviteCode returns a new random invite code, safe to use in URLs
+func inviteCode() (string, error) {
+
+	b := make([]byte, inviteCodeSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,396 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// errNotMember - only the members of a chat room can post in it
+var errNotMember = errors.New("only the members of the chat room can post in it")
+
+// JoinChatRoomPath - URL Path to join a chat room
+const JoinChatRoomPath = "/chat-rooms/{room_id}/members"
+
+// JoinChatRoom controller
+// @Summary Join chat room API
+// @Description Adds the authenticated user to the members of the chat room, joining again returns the current membership
+// @Param roomid path string true "room id"
+// @Produce json
+// @Success 200 {object} model.Membership "Success"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/members [post]
+func (realTimeChatController *RealTimeChatController) JoinChatRoom(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	room, err := realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//the members of a direct chat room are fixed, ChatRoomAccessMiddleware
+	//already rejected the private chat rooms the user was not invited to
+	if room.Type == model.ChatRoomTypeDirect {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to join the chat-room"
+		errMessage.Description = "Direct chat-rooms can not be joined"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// add member, a member joining again gets the current membership
+	result, err := realTimeChatController.repository.AddMember(model.Membership{
+		ChatRoomID: roomid,
+		UserID:     user.ID,
+		Role:       model.RoleMember,
+	})
+	if err != nil && err != repository.ErrAlreadyMember {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error joining chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// LeaveChatRoomPath - URL Path to leave a chat room
+const LeaveChatRoomPath = "/chat-rooms/{room_id}/members"
+
+// LeaveChatRoom controller
+// @Summary Leave chat room API
+// @Description Removes the authenticated user from the members of the chat room, the owner can not leave
+// @Param roomid path string true "room id"
+// @Produce json
+// @Success 200 {object} dto.SuccessMessage "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Not a member"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/members [delete]
+func (realTimeChatController *RealTimeChatController) LeaveChatRoom(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	membership, err := realTimeChatController.repository.FindMember(roomid, user.ID)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Not a member of the chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//a chat room always keeps its owner
+	if membership.Role == model.RoleOwner {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Owner can not leave the chat-room"
+		errMessage.Description = "Delete the chat-room instead"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//the members of a direct chat room are fixed
+	room, err := realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err != nil && err != repository.ErrNotFound {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if room.Type == model.ChatRoomTypeDirect {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to leave the chat-room"
+		errMessage.Description = "Direct chat-rooms can not be left"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// remove member
+	_, err = realTimeChatController.repository.RemoveMember(roomid, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error leaving chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	response := dto.SuccessMessage{
+		Message: "Chat room left successfully!",
+		ID:      roomid,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetChatRoomMembersPath - URL Path to get the members of a chat room
+const GetChatRoomMembersPath = "/chat-rooms/{room_id}/members"
+
+// GetChatRoomMembers controller
+// @Summary Get chat room members API
+// @Description Get the members of the chat room with their role in join order
+// @Param roomid path string true "room id"
+// @Produce json
+// @Success 200 {object} []model.Membership "Success"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/members [get]
+func (realTimeChatController *RealTimeChatController) GetChatRoomMembers(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	_, err = realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	result, err := realTimeChatController.repository.FindMembers(roomid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting members"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// UpdateMemberRolePath - URL Path to change the role of a member of a chat room
+const UpdateMemberRolePath = "/chat-rooms/{room_id}/members/{user_id}"
+
+// UpdateMemberRole controller
+// @Summary Update member role API
+// @Description Makes a member of the chat room an admin or a member again, only the owner can change roles
+// @Param roomid path string true "room id"
+// @Param userid path string true "user id"
+// @Param Role body dto.MemberRoleRequest true "admin or member"
+// @Produce json
+// @Success 200 {object} model.Membership "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Member not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/members/{user_id} [put]
+func (realTimeChatController *RealTimeChatController) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.MemberRoleRequest
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	vars := mux.Vars(r)
+	roomid, err := primitive.ObjectIDFromHex(vars["room_id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	uid, err := primitive.ObjectIDFromHex(vars["user_id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid user id"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// storing request body
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//there is a single owner, the one that created the chat room
+	if req.Role != model.RoleAdmin && req.Role != model.RoleMember {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid role"
+		errMessage.Description = "role must be admin or member"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	role, err := realTimeChatController.memberRole(roomid, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if role != model.RoleOwner {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to change roles"
+		errMessage.Description = "Only the owner of the chat-room can change roles"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if uid == user.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid user id"
+		errMessage.Description = "The owner can not change its own role"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// update role
+	result, err := realTimeChatController.repository.UpdateMemberRole(roomid, uid, req.Role)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Member not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error updating role"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// memberRole returns the role of the user in the room, empty when the user is
+// not a member
+func (realTimeChatController *RealTimeChatController) memberRole(roomid primitive.ObjectID, userID primitive.ObjectID) (string, error) {
+
+	membership, err := realTimeChatController.repository.FindMember(roomid, userID)
+	if err == repository.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return membership.Role, nil
+}
+
+// requireMember returns errNotMember unless the user is a member of the room
+func (realTimeChatController *RealTimeChatController) requireMember(roomid primitive.ObjectID, userID primitive.ObjectID) error {
+
+	role, err := realTimeChatController.memberRole(roomid, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return errNotMember
+	}
+
+	return nil
+}
+
+// canManageChatRoom returns true when the user can rename and delete the room
+// and invite to it, i.e. is its owner or one of its admins. A room without
+// owner can not be managed until one is assigned, see migrations/.
+func (realTimeChatController *RealTimeChatController) canManageChatRoom(roomid primitive.ObjectID, userID primitive.ObjectID) (bool, error) {
+
+	role, err := realTimeChatController.memberRole(roomid, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return role == model.RoleOwner || role == model.RoleAdmin, nil
+}
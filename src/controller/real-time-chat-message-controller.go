@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/protocol"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// EditMessagePath - URL Path to edit a message
+const EditMessagePath = "/chat-rooms/{room_id}/messages/{message_id}"
+
+// EditMessage controller
+// @Summary Edit message API
+// @Description Replaces the body of a message of the authenticated user, keeps the previous body in the edit history and broadcasts the edit to the chat room
+// @Param roomid path string true "room id"
+// @Param messageid path string true "message id"
+// @Param Message body dto.EditMessageRequest true "new body of the message"
+// @Produce json
+// @Success 200 {object} model.Message "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Message not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/messages/{message_id} [put]
+func (realTimeChatController *RealTimeChatController) EditMessage(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.EditMessageRequest
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// storing request body
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	err = protocol.ValidateBody(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid message body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// edit message
+	result, err := realTimeChatController.editMessage(roomid, user, mux.Vars(r)["message_id"], req.Body)
+	if err == errMessageNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Message not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err == errNotMessageAuthor || err == errNotMember {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to edit the message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error editing message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// DeleteMessagePath - URL Path to delete a message
+const DeleteMessagePath = "/chat-rooms/{room_id}/messages/{message_id}"
+
+// DeleteMessage controller
+// @Summary Delete message API
+// @Description Deletes a message of the authenticated user, the message is kept as a tombstone without body and the deletion is broadcasted to the chat room
+// @Param roomid path string true "room id"
+// @Param messageid path string true "message id"
+// @Produce json
+// @Success 200 {object} dto.SuccessMessage "Success"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Message not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/messages/{message_id} [delete]
+func (realTimeChatController *RealTimeChatController) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// delete message
+	result, err := realTimeChatController.deleteMessage(roomid, user, mux.Vars(r)["message_id"])
+	if err == errMessageNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Message not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err == errNotMessageAuthor || err == errNotMember {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to delete the message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error deleting message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// response message body
+	response := dto.SuccessMessage{
+		Message: "Message deleted successfully!",
+		ID:      result.ID,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// authorMessage finds a message of the room that is not deleted and checks
+// that the user wrote it and is still a member of the room
+func (realTimeChatController *RealTimeChatController) authorMessage(roomid primitive.ObjectID, user model.User, messageID string) (model.Message, error) {
+
+	//authors that left the room can no longer change their messages
+	err := realTimeChatController.requireMember(roomid, user.ID)
+	if err != nil {
+		return model.Message{}, err
+	}
+
+	message, err := realTimeChatController.findRoomMessage(roomid, messageID, 0)
+	if err != nil {
+		return message, err
+	}
+
+	if message.Deleted {
+		return message, errMessageNotFound
+	}
+
+	if message.UserID != user.ID {
+		return message, errNotMessageAuthor
+	}
+
+	return message, nil
+}
+
+// editMessage replaces the body of a message of the user and broadcasts the
+// edit to the room
+func (realTimeChatController *RealTimeChatController) editMessage(roomid primitive.ObjectID, user model.User, messageID string, body string) (model.Message, error) {
+
+	message, err := realTimeChatController.authorMessage(roomid, user, messageID)
+	if err != nil {
+		return message, err
+	}
+
+	//the message may have been deleted meanwhile
+	message, err = realTimeChatController.repository.EditMessage(message.ID, body)
+	if err == repository.ErrNotFound {
+		return message, errMessageNotFound
+	}
+	if err != nil {
+		return message, err
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeEdit, "", roomid.Hex(), &protocol.EditPayload{
+		MessageID: message.ID.Hex(),
+		Body:      message.Body,
+		Seq:       message.Seq,
+		EditedAt:  message.EditedAt,
+	})
+	if err != nil {
+		return message, err
+	}
+
+	// Send the edit to every client of the room
+	_, err = realTimeChatController.hub.Broadcast(roomid.Hex(), envelope)
+
+	return message, err
+}
+
+// deleteMessage turns a message of the user into a tombstone and broadcasts the
+// deletion to the room
+func (realTimeChatController *RealTimeChatController) deleteMessage(roomid primitive.ObjectID, user model.User, messageID string) (model.Message, error) {
+
+	message, err := realTimeChatController.authorMessage(roomid, user, messageID)
+	if err != nil {
+		return message, err
+	}
+
+	//the message may have been deleted meanwhile
+	message, err = realTimeChatController.repository.DeleteMessage(message.ID)
+	if err == repository.ErrNotFound {
+		return message, errMessageNotFound
+	}
+	if err != nil {
+		return message, err
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeDelete, "", roomid.Hex(), &protocol.DeletePayload{
+		MessageID: message.ID.Hex(),
+		Seq:       message.Seq,
+		DeletedAt: message.DeletedAt,
+	})
+	if err != nil {
+		return message, err
+	}
+
+	// Send the deletion to every client of the room
+	_, err = realTimeChatController.hub.Broadcast(roomid.Hex(), envelope)
+
+	return message, err
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/protocol"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// AddReactionPath - URL Path to react to a message with an emoji
+const AddReactionPath = "/chat-rooms/{room_id}/messages/{message_id}/reactions/{emoji}"
+
+// AddReaction controller
+// @Summary Add reaction API
+// @Description Adds the emoji reaction of the authenticated user to a message, reacting twice with the same emoji changes nothing, the reaction is broadcasted to the chat room
+// @Param roomid path string true "room id"
+// @Param messageid path string true "message id"
+// @Param emoji path string true "emoji"
+// @Produce json
+// @Success 200 {object} model.Message "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Message not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/messages/{message_id}/reactions/{emoji} [put]
+func (realTimeChatController *RealTimeChatController) AddReaction(w http.ResponseWriter, r *http.Request) {
+	realTimeChatController.reactionHandler(w, r, protocol.ReactionAdd)
+}
+
+// RemoveReactionPath - URL Path to remove an emoji reaction from a message
+const RemoveReactionPath = "/chat-rooms/{room_id}/messages/{message_id}/reactions/{emoji}"
+
+// RemoveReaction controller
+// @Summary Remove reaction API
+// @Description Removes the emoji reaction of the authenticated user from a message, the removal is broadcasted to the chat room
+// @Param roomid path string true "room id"
+// @Param messageid path string true "message id"
+// @Param emoji path string true "emoji"
+// @Produce json
+// @Success 200 {object} model.Message "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Message not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/messages/{message_id}/reactions/{emoji} [delete]
+func (realTimeChatController *RealTimeChatController) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	realTimeChatController.reactionHandler(w, r, protocol.ReactionRemove)
+}
+
+// reactionHandler adds or removes the reaction given by the request path
+func (realTimeChatController *RealTimeChatController) reactionHandler(w http.ResponseWriter, r *http.Request, action string) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	vars := mux.Vars(r)
+	roomid, err := primitive.ObjectIDFromHex(vars["room_id"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	err = protocol.ValidateEmoji(vars["emoji"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid emoji"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// add or remove reaction
+	result, err := realTimeChatController.react(roomid, user, vars["message_id"], vars["emoji"], action)
+	if err == errMessageNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Message not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err == errNotMember {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to react to the message"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error updating reactions"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// react adds or removes the emoji reaction of the user to a message of the room
+// and broadcasts it with the new number of reactions with the emoji
+func (realTimeChatController *RealTimeChatController) react(roomid primitive.ObjectID, user model.User, messageID string, emoji string, action string) (model.Message, error) {
+
+	err := realTimeChatController.requireMember(roomid, user.ID)
+	if err != nil {
+		return model.Message{}, err
+	}
+
+	message, err := realTimeChatController.findRoomMessage(roomid, messageID, 0)
+	if err != nil {
+		return message, err
+	}
+
+	if message.Deleted {
+		return message, errMessageNotFound
+	}
+
+	reaction := model.Reaction{Emoji: emoji, UserID: user.ID}
+
+	//the message may have been deleted meanwhile
+	if action == protocol.ReactionAdd {
+		message, err = realTimeChatController.repository.AddReaction(message.ID, reaction)
+	} else {
+		message, err = realTimeChatController.repository.RemoveReaction(message.ID, reaction)
+	}
+	if err == repository.ErrNotFound {
+		return message, errMessageNotFound
+	}
+	if err != nil {
+		return message, err
+	}
+
+	payload := protocol.ReactionPayload{
+		MessageID: message.ID.Hex(),
+		Emoji:     emoji,
+		Action:    action,
+		UserID:    user.ID.Hex(),
+	}
+	for _, count := range model.CountReactions(message.Reactions) {
+		if count.Emoji == emoji {
+			payload.Count = count.Count
+		}
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeReaction, "", roomid.Hex(), &payload)
+	if err != nil {
+		return message, err
+	}
+
+	// Send the reaction to every client of the room
+	_, err = realTimeChatController.hub.Broadcast(roomid.Hex(), envelope)
+
+	return message, err
+}
@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/protocol"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// MarkChatRoomReadPath - URL Path to mark a chat room as read
+const MarkChatRoomReadPath = "/chat-rooms/{room_id}/read"
+
+// MarkChatRoomRead controller
+// @Summary Mark chat room as read API
+// @Description Moves the read marker of the authenticated user forward to the given message and broadcasts the receipt to the chat room
+// @Param roomid path string true "room id"
+// @Param Read body dto.MarkReadRequest true "message id or sequence number of the last message read"
+// @Produce json
+// @Success 200 {object} dto.ReadStatus "Success"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room or message not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/read [post]
+func (realTimeChatController *RealTimeChatController) MarkChatRoomRead(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var req dto.MarkReadRequest
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// storing request body
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error decoding request body"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	if req.MessageID == "" && req.Seq <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid read position"
+		errMessage.Description = "message_id or seq is required"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	_, err = realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	// move the read marker
+	_, err = realTimeChatController.markRead(roomid, user, req.MessageID, req.Seq)
+	if err == errNotMember {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Not allowed to mark the chat-room as read"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err == errMessageNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Message not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error marking chat-room as read"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	response, err := realTimeChatController.readStatus(roomid, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error counting unread messages"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetChatRoomUnreadPath - URL Path to get the unread messages count of a chat room
+const GetChatRoomUnreadPath = "/chat-rooms/{room_id}/unread"
+
+// GetChatRoomUnread controller
+// @Summary Get chat room unread count API
+// @Description Get the read marker of the authenticated user and the number of messages of other users after it
+// @Param roomid path string true "room id"
+// @Produce json
+// @Success 200 {object} dto.ReadStatus "Success"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /chat-rooms/{room_id}/unread [get]
+func (realTimeChatController *RealTimeChatController) GetChatRoomUnread(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	user, _ := UserFromContext(r.Context())
+
+	//get paramaters
+	param := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(param)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	_, err = realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	response, err := realTimeChatController.readStatus(roomid, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error counting unread messages"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// markRead moves the read marker of the user forward to the message given by
+// its id or sequence number and broadcasts the receipt to the room, nothing is
+// broadcasted when the marker is already past the message
+func (realTimeChatController *RealTimeChatController) markRead(roomid primitive.ObjectID, user model.User, messageID string, seq int64) (model.ReadMarker, error) {
+
+	//receipts are broadcasted to the room, only its members can send them
+	err := realTimeChatController.requireMember(roomid, user.ID)
+	if err != nil {
+		return model.ReadMarker{}, err
+	}
+
+	message, err := realTimeChatController.findRoomMessage(roomid, messageID, seq)
+	if err != nil {
+		return model.ReadMarker{}, err
+	}
+
+	marker, err := realTimeChatController.repository.UpdateReadMarker(model.ReadMarker{
+		ChatRoomID: roomid,
+		UserID:     user.ID,
+		MessageID:  message.ID,
+		Seq:        message.Seq,
+	})
+	if err == repository.ErrReadMarkerBehind {
+		return marker, nil
+	}
+	if err != nil {
+		return marker, err
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeRead, "", roomid.Hex(), &protocol.ReadPayload{
+		UserID:    user.ID.Hex(),
+		MessageID: marker.MessageID.Hex(),
+		Seq:       marker.Seq,
+		ReadAt:    &marker.UpdatedAt,
+	})
+	if err != nil {
+		return marker, err
+	}
+
+	// Send the receipt to every client of the room, including the other tabs of the user
+	_, err = realTimeChatController.hub.Broadcast(roomid.Hex(), envelope)
+
+	return marker, err
+}
+
+// findRoomMessage finds the message of the room given by its id or, when the id
+// is empty, by its sequence number
+func (realTimeChatController *RealTimeChatController) findRoomMessage(roomid primitive.ObjectID, messageID string, seq int64) (model.Message, error) {
+
+	if messageID != "" {
+		id, err := primitive.ObjectIDFromHex(messageID)
+		if err != nil {
+			return model.Message{}, errMessageNotFound
+		}
+
+		message, err := realTimeChatController.repository.FindMessageByID(id)
+		if err == repository.ErrNotFound || (err == nil && message.ChatRoomID != roomid) {
+			return model.Message{}, errMessageNotFound
+		}
+
+		return message, err
+	}
+
+	messages, err := realTimeChatController.repository.FindMessagesAfterSeq(roomid, seq-1, 1)
+	if err != nil {
+		return model.Message{}, err
+	}
+	if len(messages) == 0 || messages[0].Seq != seq {
+		return model.Message{}, errMessageNotFound
+	}
+
+	return messages[0], nil
+}
+
+// readStatus returns the read marker of the user in the room with the number
+// of messages of other users after it
+func (realTimeChatController *RealTimeChatController) readStatus(roomid primitive.ObjectID, user model.User) (dto.ReadStatus, error) {
+
+	status := dto.ReadStatus{ChatRoomID: roomid.Hex()}
+
+	//a user that never read the room has read nothing
+	marker, err := realTimeChatController.repository.FindReadMarker(roomid, user.ID)
+	if err != nil && err != repository.ErrNotFound {
+		return status, err
+	}
+	if err == nil {
+		status.LastReadMessageID = marker.MessageID.Hex()
+		status.LastReadSeq = marker.Seq
+	}
+
+	status.Unread, err = realTimeChatController.repository.CountUnreadMessages(roomid, user.ID, status.LastReadSeq)
+
+	return status, err
+}
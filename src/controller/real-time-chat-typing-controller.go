@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"github.com/Tainzen/realtime-chat/src/hub"
+	"github.com/Tainzen/realtime-chat/src/protocol"
+	"github.com/rs/zerolog"
+	"sync"
+	"time"
+)
+
+// typingState - typing indicator of a single connection, typing events are
+// only fanned out to the other clients of the room and never stored
+type typingState struct {
+	room   *hub.Room
+	client *hub.Client
+	userID string
+	logger zerolog.Logger
+
+	//minimum time between two typing start events of the connection, starts
+	//received in between only extend the expiry
+	throttle time.Duration
+	//typing stops automatically when no start is received for this long, e.g.
+	//the client went away without sending stop
+	timeout time.Duration
+
+	mu        sync.Mutex
+	typing    bool
+	lastStart time.Time
+	lastSent  time.Time
+	expiry    *time.Timer
+}
+
+// newTypingState - returns the typing state of the client, not typing
+func newTypingState(room *hub.Room, client *hub.Client, userID string, logger zerolog.Logger, throttle time.Duration, timeout time.Duration) *typingState {
+	return &typingState{
+		room:     room,
+		client:   client,
+		userID:   userID,
+		logger:   logger,
+		throttle: throttle,
+		timeout:  timeout,
+	}
+}
+
+// handle - applies a typing frame of the client
+func (state *typingState) handle(payload *protocol.TypingPayload) error {
+	if payload.Status == protocol.TypingStart {
+		return state.start()
+	}
+	return state.stop()
+}
+
+// start - user is typing, broadcasts start unless one was sent within the
+// throttle and restarts the expiry
+func (state *typingState) start() error {
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.expiry != nil {
+		state.expiry.Stop()
+	}
+	state.expiry = time.AfterFunc(state.timeout, state.expire)
+
+	now := time.Now()
+	state.lastStart = now
+
+	if state.typing && now.Sub(state.lastSent) < state.throttle {
+		return nil
+	}
+
+	state.typing = true
+	state.lastSent = now
+
+	return state.broadcast(protocol.TypingStart)
+}
+
+// stop - user stopped typing, broadcasts stop if start was broadcasted
+func (state *typingState) stop() error {
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.stopLocked()
+}
+
+// stopLocked - same as stop, state.mu must be held
+func (state *typingState) stopLocked() error {
+
+	if state.expiry != nil {
+		state.expiry.Stop()
+		state.expiry = nil
+	}
+
+	if !state.typing {
+		return nil
+	}
+
+	state.typing = false
+
+	return state.broadcast(protocol.TypingStop)
+}
+
+// expire - no start received within the timeout
+func (state *typingState) expire() {
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	//a start may have been received while the timer fired
+	if time.Since(state.lastStart) < state.timeout {
+		return
+	}
+
+	err := state.stopLocked()
+	if err != nil {
+		state.logger.Error().Err(err).Str("room_id", state.room.ID).Msg("Error expiring typing indicator")
+	}
+}
+
+// broadcast - sends the typing status to the other clients of the room,
+// state.mu must be held
+func (state *typingState) broadcast(status string) error {
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeTyping, "", state.room.ID, &protocol.TypingPayload{
+		UserID: state.userID,
+		Status: status,
+	})
+	if err != nil {
+		return err
+	}
+
+	return state.room.BroadcastExcept(state.client, envelope)
+}
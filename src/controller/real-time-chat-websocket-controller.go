@@ -0,0 +1,615 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Tainzen/realtime-chat/src/controller/dto"
+	"github.com/Tainzen/realtime-chat/src/hub"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/protocol"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxFrameSize - biggest frame accepted from clients, the connection is
+// closed with CloseMessageTooBig when a bigger frame is received
+const maxFrameSize = 16 * 1024
+
+// replayPageSize - number of missed messages read at once when resuming
+const replayPageSize = 100
+
+// errInvalidResume - last_seq or last_message_id can not be resumed from
+var errInvalidResume = errors.New("invalid resume position")
+
+// errTypeNotAllowed - frame type can only be sent by the server
+var errTypeNotAllowed = errors.New("frame type can only be sent by the server")
+
+// errMessageNotFound - message does not exist in the chat room
+var errMessageNotFound = errors.New("message not found in the chat room")
+
+// errNotMessageAuthor - only the author of a message can change it
+var errNotMessageAuthor = errors.New("only the author can change the message")
+
+// closeError - fatal error closing the connection with a websocket close code
+type closeError struct {
+	code   int
+	reason string
+}
+
+// Error - reason of the close
+func (err *closeError) Error() string {
+	return err.reason
+}
+
+// handleConnections registers the client into its room and serves it until
+// the connection is closed, fatal errors close the connection with a close frame.
+// When resume is set the messages after resumeSeq are replayed first.
+func (realTimeChatController *RealTimeChatController) handleConnections(client *hub.Client, ws *websocket.Conn, roomid primitive.ObjectID, user model.User, resume bool, resumeSeq int64) {
+
+	//live messages are kept aside while replaying, a long replay would
+	//overflow the send queue otherwise
+	if resume {
+		client.Hold()
+	}
+
+	// Register our new client, live messages are queued from now on
+	room, online := realTimeChatController.hub.Join(roomid.Hex(), client)
+	if online {
+		realTimeChatController.broadcastPresence(room, client, user, protocol.PresenceJoin)
+	}
+
+	var err error
+	if resume {
+		err = realTimeChatController.replayMessages(client, room, roomid, resumeSeq)
+		room.Release(client)
+	}
+
+	go client.WritePump()
+
+	typing := newTypingState(room, client, user.ID.Hex(), realTimeChatController.logger, realTimeChatController.typingThrottle, realTimeChatController.typingTimeout)
+
+	if err == nil {
+		err = realTimeChatController.readFrames(room, client, ws, roomid, user, typing)
+	}
+
+	//the others must not see the user typing forever
+	if stopErr := typing.stop(); stopErr != nil {
+		realTimeChatController.logger.Error().Err(stopErr).Str("room_id", room.ID).Msg("Error stopping typing indicator")
+	}
+
+	if err != nil {
+		//the connection is hijacked, report fatal errors with a close frame
+		closeErr, ok := err.(*closeError)
+		if !ok {
+			realTimeChatController.logger.Error().Err(err).Str("room_id", room.ID).Msg("Error handling websocket connection")
+			closeErr = &closeError{code: websocket.CloseInternalServerErr, reason: "internal error"}
+		}
+		client.SetCloseReason(closeErr.code, closeErr.reason)
+	}
+
+	//leaving the room makes WritePump send the close frame and return
+	offline := realTimeChatController.hub.Leave(client)
+	if offline {
+		realTimeChatController.broadcastPresence(room, client, user, protocol.PresenceLeave)
+	}
+	<-client.Done()
+}
+
+// broadcastPresence tells the other clients of the room that the user came
+// online or went offline, the other tabs of the user do not change it
+func (realTimeChatController *RealTimeChatController) broadcastPresence(room *hub.Room, client *hub.Client, user model.User, status string) {
+
+	envelope, err := protocol.NewEnvelope(protocol.TypePresence, "", room.ID, &protocol.PresencePayload{
+		UserID: user.ID.Hex(),
+		Status: status,
+	})
+	if err == nil {
+		err = room.BroadcastExcept(client, envelope)
+	}
+	if err != nil {
+		realTimeChatController.logger.Error().Err(err).Str("room_id", room.ID).Msg("Error broadcasting presence")
+	}
+}
+
+// replayMessages writes the stored messages with a sequence number greater
+// than afterSeq to the connection, followed by a replay_complete system frame.
+// The client already joined the room so messages broadcast meanwhile are kept
+// aside, the replayed ones are marked delivered so that WritePump skips them.
+// It must run before WritePump, it writes to the connection directly.
+func (realTimeChatController *RealTimeChatController) replayMessages(client *hub.Client, room *hub.Room, roomid primitive.ObjectID, afterSeq int64) error {
+
+	for {
+		messages, err := realTimeChatController.repository.FindMessagesAfterSeq(roomid, afterSeq, replayPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			envelope, err := protocol.NewEnvelope(protocol.TypeMessage, "", room.ID, messagePayload(message))
+			if err != nil {
+				return err
+			}
+
+			err = client.WriteNow(envelope)
+			if err != nil {
+				return err
+			}
+
+			client.MarkDelivered(message.Seq)
+			afterSeq = message.Seq
+		}
+
+		if len(messages) < replayPageSize {
+			break
+		}
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeSystem, "", room.ID, &protocol.SystemPayload{
+		Event: protocol.SystemEventReplayComplete,
+	})
+	if err != nil {
+		return err
+	}
+
+	return client.WriteNow(envelope)
+}
+
+// readFrames reads the frames of the connection and dispatches them by type,
+// frames that can not be processed are answered with an error frame and the
+// connection is kept open
+func (realTimeChatController *RealTimeChatController) readFrames(room *hub.Room, client *hub.Client, ws *websocket.Conn, roomid primitive.ObjectID, user model.User, typing *typingState) error {
+
+	ws.SetReadLimit(maxFrameSize)
+
+	for {
+		// Read in a new frame
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			//connection closed by the client or dropped, frames over
+			//maxFrameSize are closed by the websocket library
+			return nil
+		}
+
+		if messageType != websocket.TextMessage {
+			return &closeError{code: websocket.CloseUnsupportedData, reason: "only text frames are supported"}
+		}
+
+		envelope, payload, err := protocol.Decode(data)
+		if err == nil {
+			//a connection only serves its own room
+			err = envelope.CheckRoom(room.ID)
+		}
+		if err == nil {
+			switch payload := payload.(type) {
+			case *protocol.MessagePayload:
+				err = realTimeChatController.handleChatMessage(room, client, roomid, user, envelope.ID, payload)
+				if err == nil {
+					//sending a message ends typing
+					err = typing.stop()
+				}
+			case *protocol.TypingPayload:
+				err = realTimeChatController.requireMember(roomid, user.ID)
+				if err == nil {
+					err = typing.handle(payload)
+				}
+			case *protocol.ReadPayload:
+				_, err = realTimeChatController.markRead(roomid, user, payload.MessageID, payload.Seq)
+			case *protocol.EditPayload:
+				err = realTimeChatController.handleEditMessage(room, client, roomid, user, envelope.ID, payload)
+			case *protocol.DeletePayload:
+				err = realTimeChatController.handleDeleteMessage(room, client, roomid, user, envelope.ID, payload)
+			case *protocol.ReactionPayload:
+				err = realTimeChatController.handleReaction(room, client, roomid, user, envelope.ID, payload)
+			default:
+				err = errTypeNotAllowed
+			}
+		}
+
+		if err != nil {
+			err = realTimeChatController.sendError(room, client, envelope.ID, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+}
+
+// sendError reports the error of the frame with the given id to the client
+func (realTimeChatController *RealTimeChatController) sendError(room *hub.Room, client *hub.Client, id string, err error) error {
+
+	payload := protocol.ErrorPayload{
+		Message: err.Error(),
+	}
+
+	switch {
+	case errors.Is(err, protocol.ErrUnsupportedVersion):
+		payload.Code = protocol.ErrorCodeUnsupportedVersion
+	case errors.Is(err, protocol.ErrUnknownType):
+		payload.Code = protocol.ErrorCodeUnknownType
+	case errors.Is(err, protocol.ErrInvalidPayload):
+		payload.Code = protocol.ErrorCodeInvalidFrame
+	case errors.Is(err, protocol.ErrRoomMismatch):
+		payload.Code = protocol.ErrorCodeRoomMismatch
+	case errors.Is(err, errTypeNotAllowed):
+		payload.Code = protocol.ErrorCodeTypeNotAllowed
+	case errors.Is(err, errMessageNotFound):
+		payload.Code = protocol.ErrorCodeNotFound
+	case errors.Is(err, errNotMessageAuthor), errors.Is(err, errNotMember):
+		payload.Code = protocol.ErrorCodeForbidden
+	default:
+		//do not leak internal details to the client
+		realTimeChatController.logger.Error().Err(err).Str("room_id", room.ID).Msg("Error processing websocket frame")
+		payload.Code = protocol.ErrorCodeInternal
+		payload.Message = "Error processing frame, please try again"
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeError, id, room.ID, &payload)
+	if err != nil {
+		return err
+	}
+
+	return room.Send(client, envelope)
+}
+
+// handleChatMessage saves the chat message as sent by the authenticated user,
+// acknowledges it to the sender with the frame id and broadcasts the stored
+// message to the room
+func (realTimeChatController *RealTimeChatController) handleChatMessage(room *hub.Room, client *hub.Client, roomid primitive.ObjectID, user model.User, id string, payload *protocol.MessagePayload) error {
+
+	//watching a chat room does not make a member
+	err := realTimeChatController.requireMember(roomid, user.ID)
+	if err != nil {
+		return err
+	}
+
+	//the sender is always the user bound to the connection, a
+	//user_id supplied in the payload is ignored
+	m := model.Message{
+		UserID:          user.ID,
+		ChatRoomID:      roomid,
+		Body:            payload.Body,
+		ClientMessageID: payload.ClientMessageID,
+	}
+
+	if payload.ParentID != "" {
+		threadID, err := realTimeChatController.threadID(roomid, payload.ParentID)
+		if err != nil {
+			return err
+		}
+		m.ParentID = &threadID
+	}
+
+	//create message, a resent message returns the stored one
+	saved, err := realTimeChatController.repository.CreateMessage(m)
+	duplicate := err == repository.ErrDuplicateMessage
+	if err != nil && !duplicate {
+		return err
+	}
+
+	ack, err := protocol.NewEnvelope(protocol.TypeAck, id, room.ID, &protocol.AckPayload{
+		MessageID: saved.ID.Hex(),
+		Duplicate: duplicate,
+		Seq:       saved.Seq,
+		CreatedAt: &saved.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = room.Send(client, ack)
+	if err != nil {
+		return err
+	}
+
+	//the room already received the original
+	if duplicate {
+		return nil
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeMessage, "", room.ID, messagePayload(saved))
+	if err != nil {
+		return err
+	}
+
+	// Send the stored message to every client of the room
+	err = room.BroadcastSeq(saved.Seq, envelope)
+	if err != nil || saved.ParentID == nil {
+		return err
+	}
+
+	return realTimeChatController.addReply(room, *saved.ParentID, saved.CreatedAt)
+}
+
+// threadID returns the id of the message starting the thread of the given
+// message of the room, replies to a reply join the thread of their parent
+func (realTimeChatController *RealTimeChatController) threadID(roomid primitive.ObjectID, parentID string) (primitive.ObjectID, error) {
+
+	parent, err := realTimeChatController.findRoomMessage(roomid, parentID, 0)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	if parent.Deleted {
+		return primitive.NilObjectID, errMessageNotFound
+	}
+
+	if parent.ParentID != nil {
+		return *parent.ParentID, nil
+	}
+
+	return parent.ID, nil
+}
+
+// addReply counts the reply into its thread and broadcasts the new reply count
+// so that clients can update the message starting the thread
+func (realTimeChatController *RealTimeChatController) addReply(room *hub.Room, threadID primitive.ObjectID, replyAt time.Time) error {
+
+	parent, err := realTimeChatController.repository.AddReply(threadID, replyAt)
+	if err != nil {
+		return err
+	}
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeThread, "", room.ID, &protocol.ThreadPayload{
+		MessageID:   parent.ID.Hex(),
+		ReplyCount:  parent.ReplyCount,
+		LastReplyAt: parent.LastReplyAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return room.Broadcast(envelope)
+}
+
+// handleEditMessage edits the message of the user, acknowledges it to the
+// sender with the frame id and broadcasts the edit to the room
+func (realTimeChatController *RealTimeChatController) handleEditMessage(room *hub.Room, client *hub.Client, roomid primitive.ObjectID, user model.User, id string, payload *protocol.EditPayload) error {
+
+	message, err := realTimeChatController.editMessage(roomid, user, payload.MessageID, payload.Body)
+	if err != nil {
+		return err
+	}
+
+	ack, err := protocol.NewEnvelope(protocol.TypeAck, id, room.ID, &protocol.AckPayload{
+		MessageID: message.ID.Hex(),
+		Seq:       message.Seq,
+	})
+	if err != nil {
+		return err
+	}
+
+	return room.Send(client, ack)
+}
+
+// handleDeleteMessage deletes the message of the user, acknowledges it to the
+// sender with the frame id and broadcasts the deletion to the room
+func (realTimeChatController *RealTimeChatController) handleDeleteMessage(room *hub.Room, client *hub.Client, roomid primitive.ObjectID, user model.User, id string, payload *protocol.DeletePayload) error {
+
+	message, err := realTimeChatController.deleteMessage(roomid, user, payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	ack, err := protocol.NewEnvelope(protocol.TypeAck, id, room.ID, &protocol.AckPayload{
+		MessageID: message.ID.Hex(),
+		Seq:       message.Seq,
+	})
+	if err != nil {
+		return err
+	}
+
+	return room.Send(client, ack)
+}
+
+// handleReaction adds or removes the reaction of the user, acknowledges it to
+// the sender with the frame id and broadcasts it to the room
+func (realTimeChatController *RealTimeChatController) handleReaction(room *hub.Room, client *hub.Client, roomid primitive.ObjectID, user model.User, id string, payload *protocol.ReactionPayload) error {
+
+	message, err := realTimeChatController.react(roomid, user, payload.MessageID, payload.Emoji, payload.Action)
+	if err != nil {
+		return err
+	}
+
+	ack, err := protocol.NewEnvelope(protocol.TypeAck, id, room.ID, &protocol.AckPayload{
+		MessageID: message.ID.Hex(),
+		Seq:       message.Seq,
+	})
+	if err != nil {
+		return err
+	}
+
+	return room.Send(client, ack)
+}
+
+// messagePayload builds the payload of a stored message
+func messagePayload(message model.Message) *protocol.MessagePayload {
+
+	createdAt := message.CreatedAt
+
+	var parentID string
+	if message.ParentID != nil {
+		parentID = message.ParentID.Hex()
+	}
+
+	var reactions []protocol.ReactionCount
+	for _, count := range model.CountReactions(message.Reactions) {
+		userIDs := make([]string, 0, len(count.UserIDs))
+		for _, userID := range count.UserIDs {
+			userIDs = append(userIDs, userID.Hex())
+		}
+		reactions = append(reactions, protocol.ReactionCount{
+			Emoji:   count.Emoji,
+			Count:   count.Count,
+			UserIDs: userIDs,
+		})
+	}
+
+	return &protocol.MessagePayload{
+		ID:              message.ID.Hex(),
+		RoomID:          message.ChatRoomID.Hex(),
+		UserID:          message.UserID.Hex(),
+		ClientMessageID: message.ClientMessageID,
+		ParentID:        parentID,
+		Body:            message.Body,
+		Seq:             message.Seq,
+		CreatedAt:       &createdAt,
+		EditedAt:        message.EditedAt,
+		Deleted:         message.Deleted,
+		ReplyCount:      message.ReplyCount,
+		LastReplyAt:     message.LastReplyAt,
+		Reactions:       reactions,
+	}
+}
+
+const ChatRoomWebsocket = "/ws/chat-room/{room_id}"
+
+// WebSocketHandler controller
+// @Summary Websocket handler API
+// @Description Websocket handler api to initiate websockets, the bearer token is read from the Authorization header,
+// @Description the token query parameter or the "bearer, <token>" websocket subprotocols
+// @Param roomid path string true "room id"
+// @Param token query string false "bearer token"
+// @Param last_seq query int false "replay the messages after this sequence number before live delivery"
+// @Param last_message_id query string false "replay the messages after this message before live delivery"
+// @Failure 400 {object} dto.ErrorMessage "Bad Request"
+// @Param Frame body protocol.Envelope true "Frames exchanged over the websocket"
+// @Produce json
+// @Success 200 {object} dto.SuccessMessage "Success"
+// @Failure 401 {object} dto.ErrorMessage "Unauthorized"
+// @Failure 403 {object} dto.ErrorMessage "Forbidden"
+// @Failure 404 {object} dto.ErrorMessage "Chat-room not found"
+// @Failure 500 {object} dto.ErrorMessage "Internal Server Error"
+// @Security BearerAuth
+// @Router /ws/chat-room/{room_id} [get]
+func (realTimeChatController *RealTimeChatController) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+
+	//adding Content-type for the errors returned before upgrading
+	w.Header().Set("Content-Type", "application/json")
+
+	var errMessage dto.ErrorMessage
+
+	//authenticate before upgrading, the identity is bound to the connection
+	user, err := realTimeChatController.authenticate(websocketToken(r))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		errMessage.Message = "Invalid bearer token"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get paramaters
+	rid := mux.Vars(r)["room_id"]
+	roomid, err := primitive.ObjectIDFromHex(rid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error while converting roomid to ObjectID"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//get chat room by id to check if room id is present or not
+	chatRoom, err := realTimeChatController.repository.FindChatRoomByID(roomid)
+	if err == repository.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		errMessage.Message = "Chat-room not found"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting chat-room"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	access, err := realTimeChatController.chatRoomAccess(chatRoom, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting membership"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if !access {
+		w.WriteHeader(http.StatusForbidden)
+		errMessage.Message = "Chat-room access denied"
+		errMessage.Description = "Only the members of the chat-room can access it"
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//resume after the last message seen by the client
+	resume, resumeSeq, err := realTimeChatController.resumeSeq(r, roomid)
+	if errors.Is(err, errInvalidResume) {
+		w.WriteHeader(http.StatusBadRequest)
+		errMessage.Message = "Invalid resume position"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		errMessage.Message = "Error getting resume position"
+		errMessage.Description = err.Error()
+		json.NewEncoder(w).Encode(errMessage)
+		return
+	}
+
+	//the upgrader replies with an http error itself when upgrading fails
+	conn, err := realTimeChatController.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		realTimeChatController.logger.Debug().Err(err).Str("room_id", rid).Msg("Error while upgrading http connection to websockets")
+		return
+	}
+
+	defer conn.Close()
+
+	//handle connection
+	realTimeChatController.handleConnections(hub.NewClient(conn, user.ID.Hex()), conn, roomid, user, resume, resumeSeq)
+
+}
+
+// resumeSeq returns the sequence number after which missed messages are
+// replayed, read from the last_seq or last_message_id query parameters
+func (realTimeChatController *RealTimeChatController) resumeSeq(r *http.Request, roomid primitive.ObjectID) (bool, int64, error) {
+
+	query := r.URL.Query()
+
+	if value := query.Get("last_seq"); value != "" {
+		seq, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seq < 0 {
+			return false, 0, fmt.Errorf("%w: last_seq must be a non-negative number", errInvalidResume)
+		}
+		return true, seq, nil
+	}
+
+	if value := query.Get("last_message_id"); value != "" {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return false, 0, fmt.Errorf("%w: %v", errInvalidResume, err)
+		}
+
+		message, err := realTimeChatController.repository.FindMessageByID(id)
+		if err == repository.ErrNotFound || (err == nil && message.ChatRoomID != roomid) {
+			return false, 0, fmt.Errorf("%w: last_message_id is not a message of the chat-room", errInvalidResume)
+		}
+		if err != nil {
+			return false, 0, err
+		}
+
+		return true, message.Seq, nil
+	}
+
+	return false, 0, nil
+}
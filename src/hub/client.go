@@ -0,0 +1,185 @@
+package hub
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// outbound - encoded message queued for a client
+type outbound struct {
+	//sequence number of a chat message, 0 for other messages
+	seq  int64
+	data []byte
+}
+
+// Client - a websocket connection that joined a room
+type Client struct {
+	conn   *websocket.Conn
+	userID string
+	room   *Room
+	config Config
+	send   chan outbound
+	done   chan struct{}
+
+	//unix nano time of the last pong, updated atomically
+	lastSeenAt int64
+
+	//sequence numbers already written to the connection before WritePump
+	//started, only accessed by the goroutine running WritePump
+	delivered map[int64]bool
+
+	//while held the room keeps the messages of the client in pending
+	//instead of its send queue, both are owned by the room until it
+	//releases the client and by WritePump afterwards
+	held    bool
+	pending []outbound
+
+	mu sync.Mutex
+	//close frame written once the client left its room
+	closeFrame []byte
+}
+
+// NewClient - wraps the websocket connection of the given user into a client,
+// a user can have several clients in the same room, e.g. several tabs
+func NewClient(conn *websocket.Conn, userID string) *Client {
+	return &Client{
+		conn:   conn,
+		userID: userID,
+		done:   make(chan struct{}),
+	}
+}
+
+// SetCloseReason - close code and reason sent to the client when it leaves
+// its room, only the first reason is kept
+func (client *Client) SetCloseReason(code int, reason string) {
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.closeFrame == nil {
+		client.closeFrame = websocket.FormatCloseMessage(code, reason)
+	}
+}
+
+// Hold - makes the room keep the messages of the client aside, outside of the
+// send queue and its overflow policy, until Room.Release is called. It must be
+// called before joining, e.g. while missed messages are written with WriteNow.
+func (client *Client) Hold() {
+	client.held = true
+}
+
+// MarkDelivered - records that the message with the given sequence number was
+// already written to the connection, e.g. when replaying missed messages, so
+// that WritePump does not write it twice. It must be called before WritePump.
+func (client *Client) MarkDelivered(seq int64) {
+
+	if client.delivered == nil {
+		client.delivered = make(map[int64]bool)
+	}
+
+	client.delivered[seq] = true
+}
+
+// WriteNow - encodes v as JSON and writes it to the connection right away, it
+// must only be used after joining a room and before WritePump is started
+func (client *Client) WriteNow(v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	client.conn.SetWriteDeadline(time.Now().Add(client.config.WriteWait))
+
+	return client.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// touch - records that the client is alive and gives it PongWait to answer
+// the next ping, reading the connection fails after that
+func (client *Client) touch() {
+
+	now := time.Now()
+	atomic.StoreInt64(&client.lastSeenAt, now.UnixNano())
+
+	client.conn.SetReadDeadline(now.Add(client.config.PongWait))
+}
+
+// lastSeen - last time the client was known to be alive
+func (client *Client) lastSeen() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&client.lastSeenAt))
+}
+
+// Done - closed once WritePump returned
+func (client *Client) Done() <-chan struct{} {
+	return client.done
+}
+
+// WritePump - writes the messages broadcast to the client into its connection
+// and pings it every PingInterval, it is the only goroutine allowed to write to
+// the connection
+func (client *Client) WritePump() {
+
+	ticker := time.NewTicker(client.config.PingInterval)
+
+	defer close(client.done)
+	defer client.conn.Close()
+	defer ticker.Stop()
+
+	//messages kept aside while the client was held come first
+	for _, msg := range client.pending {
+		if err := client.write(msg); err != nil {
+			return
+		}
+	}
+	client.pending = nil
+
+	for {
+		select {
+		case msg, ok := <-client.send:
+			if !ok {
+				//room closed the send channel
+				client.writeClose()
+				return
+			}
+
+			if err := client.write(msg); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(client.config.WriteWait))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write - writes the message to the connection unless it was already
+// delivered
+func (client *Client) write(msg outbound) error {
+
+	if msg.seq != 0 && client.delivered[msg.seq] {
+		delete(client.delivered, msg.seq)
+		return nil
+	}
+
+	client.conn.SetWriteDeadline(time.Now().Add(client.config.WriteWait))
+
+	return client.conn.WriteMessage(websocket.TextMessage, msg.data)
+}
+
+// writeClose - writes the close frame of the client
+func (client *Client) writeClose() {
+
+	client.SetCloseReason(websocket.CloseNormalClosure, "")
+
+	client.mu.Lock()
+	closeFrame := client.closeFrame
+	client.mu.Unlock()
+
+	client.conn.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(client.config.WriteWait))
+}
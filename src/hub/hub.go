@@ -0,0 +1,200 @@
+package hub
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy - what a room does when the send queue of a client is full
+type OverflowPolicy string
+
+// Overflow policies
+const (
+	// OverflowDropOldest - the oldest queued message of the client is dropped
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDisconnect - the client is disconnected
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowBlock - the room waits up to OverflowTimeout for room in the
+	// queue, then disconnects the client
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// Config - heartbeat and send queue settings of the connections
+type Config struct {
+	// interval between two pings sent to every client
+	PingInterval time.Duration
+	// clients that did not answer a ping for this long are reaped
+	PongWait time.Duration
+	// time allowed to write a message to a client
+	WriteWait time.Duration
+	// number of outbound messages queued per client
+	SendQueueSize int
+	// what to do when the send queue of a client is full
+	OverflowPolicy OverflowPolicy
+	// longest wait for room in a full queue with OverflowBlock
+	OverflowTimeout time.Duration
+}
+
+// Stats - counters of the hub
+type Stats struct {
+	Rooms   int   `json:"rooms"`
+	Clients int   `json:"clients"`
+	Reaped  int64 `json:"reaped"`
+	// messages dropped from full send queues
+	Dropped int64 `json:"dropped"`
+	// clients disconnected because their send queue was full
+	SlowDisconnected int64 `json:"slow_disconnected"`
+}
+
+// Hub - keeps track of the active chat rooms, a room is created lazily when
+// the first client joins and torn down when the last client leaves.
+// The hub owns the rooms map and the reference counts of the rooms, both are
+// only accessed with mu held. Each room owns its own client set.
+type Hub struct {
+	config Config
+
+	mu    sync.Mutex
+	rooms map[string]*Room
+
+	//counters of the rooms, updated atomically
+	reaped           int64
+	dropped          int64
+	slowDisconnected int64
+}
+
+// NewHub - returns an empty hub using the given heartbeat settings
+func NewHub(config Config) *Hub {
+	return &Hub{
+		config: config,
+		rooms:  make(map[string]*Room),
+	}
+}
+
+// Join - registers the client into the room with the given id, starting the
+// room if it is not running yet. It returns true when this is the first client
+// of the user in the room, i.e. the user came online.
+func (hub *Hub) Join(roomID string, client *Client) (*Room, bool) {
+
+	hub.mu.Lock()
+	room, ok := hub.rooms[roomID]
+	if !ok {
+		room = newRoom(hub, roomID)
+		hub.rooms[roomID] = room
+		go room.run()
+	}
+	//the reference keeps the room alive until the client leaves
+	room.refs++
+	room.online[client.userID]++
+	first := room.online[client.userID] == 1
+	hub.mu.Unlock()
+
+	client.room = room
+	client.config = hub.config
+	client.send = make(chan outbound, hub.config.SendQueueSize)
+	//the pong handler runs on the goroutine reading the connection
+	client.touch()
+	client.conn.SetPongHandler(func(string) error {
+		client.touch()
+		return nil
+	})
+	room.register <- client
+
+	return room, first
+}
+
+// Leave - unregisters the client from its room and stops the room once it
+// has no more clients. It returns true when this was the last client of the
+// user in the room, i.e. the user went offline.
+func (hub *Hub) Leave(client *Client) bool {
+
+	room := client.room
+	if room == nil {
+		return false
+	}
+	client.room = nil
+
+	room.unregister <- client
+
+	hub.mu.Lock()
+	room.refs--
+	room.online[client.userID]--
+	last := room.online[client.userID] == 0
+	if last {
+		delete(room.online, client.userID)
+	}
+	if room.refs == 0 {
+		delete(hub.rooms, room.ID)
+		close(room.stop)
+	}
+	hub.mu.Unlock()
+
+	return last
+}
+
+// Broadcast - sends v to every client of the room with the given id, it
+// returns false when nobody is connected to the room
+func (hub *Hub) Broadcast(roomID string, v interface{}) (bool, error) {
+
+	hub.mu.Lock()
+	room, ok := hub.rooms[roomID]
+	hub.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	err := room.Broadcast(v)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Online - ids of the users with at least one client in the room with the
+// given id, sorted
+func (hub *Hub) Online(roomID string) []string {
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	users := []string{}
+	if room, ok := hub.rooms[roomID]; ok {
+		for userID := range room.online {
+			users = append(users, userID)
+		}
+	}
+	sort.Strings(users)
+
+	return users
+}
+
+// RoomCount - number of rooms with at least one client
+func (hub *Hub) RoomCount() int {
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	return len(hub.rooms)
+}
+
+// Stats - returns the current counters of the hub
+func (hub *Hub) Stats() Stats {
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	stats := Stats{
+		Rooms:            len(hub.rooms),
+		Reaped:           atomic.LoadInt64(&hub.reaped),
+		Dropped:          atomic.LoadInt64(&hub.dropped),
+		SlowDisconnected: atomic.LoadInt64(&hub.slowDisconnected),
+	}
+	for _, room := range hub.rooms {
+		stats.Clients += room.refs
+	}
+
+	return stats
+}
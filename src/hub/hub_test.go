@@ -0,0 +1,538 @@
+package hub
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitTimeout - longest wait for the hub to reach an expected state
+const waitTimeout = 5 * time.Second
+
+// testServer - websocket server joining every connection to a hub, the way
+// the websocket controller does
+type testServer struct {
+	*httptest.Server
+	hub *Hub
+	//errors that ended the reads of the connections
+	readErrs chan error
+	//the writers of the slow connections wait for it to be closed
+	slow     chan struct{}
+	slowOnce sync.Once
+}
+
+// testConfig - settings with heartbeats longer than the tests and a roomy
+// send queue
+func testConfig() Config {
+	return Config{
+		PingInterval:    time.Minute,
+		PongWait:        2 * time.Minute,
+		WriteWait:       time.Second,
+		SendQueueSize:   16,
+		OverflowPolicy:  OverflowDisconnect,
+		OverflowTimeout: time.Second,
+	}
+}
+
+// newTestServer - starts a server on a hub with the config, closed at the end
+// of the test. Connections join the room and user given by the room and user
+// query parameters, the ones with the slow parameter get no message until
+// resumeSlow is called.
+func newTestServer(t *testing.T, config Config) *testServer {
+
+	upgrader := websocket.Upgrader{}
+	ts := &testServer{
+		hub:      NewHub(config),
+		readErrs: make(chan error, 1024),
+		slow:     make(chan struct{}),
+	}
+
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		client := NewClient(conn, r.URL.Query().Get("user"))
+		ts.hub.Join(r.URL.Query().Get("room"), client)
+		if r.URL.Query().Get("slow") != "" {
+			go func() {
+				<-ts.slow
+				client.WritePump()
+			}()
+		} else {
+			go client.WritePump()
+		}
+
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				ts.readErrs <- err
+				break
+			}
+		}
+
+		ts.hub.Leave(client)
+		<-client.Done()
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(ts.resumeSlow)
+
+	return ts
+}
+
+// resumeSlow - lets the writers of the slow connections start
+func (ts *testServer) resumeSlow() {
+	ts.slowOnce.Do(func() { close(ts.slow) })
+}
+
+// dial - connects the user to the room, the connection is closed at the end
+// of the test
+func (ts *testServer) dial(t *testing.T, roomID string, userID string) *websocket.Conn {
+	t.Helper()
+	return ts.dialURL(t, "/?room="+roomID+"&user="+userID)
+}
+
+// dialSlow - same as dial for a connection whose messages stay queued until
+// resumeSlow is called, like a client not reading them
+func (ts *testServer) dialSlow(t *testing.T, roomID string, userID string) *websocket.Conn {
+	t.Helper()
+	return ts.dialURL(t, "/?room="+roomID+"&user="+userID+"&slow=1")
+}
+
+// dialURL - connects to the path of the server
+func (ts *testServer) dialURL(t *testing.T, path string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// waitFor - waits until the condition holds, failing the test with what
+// otherwise
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// readLoop - reads the connection in the background, answering pings, until
+// it fails. The returned channel receives the error.
+func readLoop(conn *websocket.Conn) <-chan error {
+
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	return errs
+}
+
+// serverConn - returns the server side of a new websocket connection, both
+// sides are closed at the end of the test
+func serverConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// testMessage - message broadcast by the tests
+type testMessage struct {
+	N int `json:"n"`
+}
+
+// broadcast - broadcasts the messages numbered from..to-1 to the room
+func (ts *testServer) broadcast(t *testing.T, roomID string, from int, to int) {
+	t.Helper()
+
+	for n := from; n < to; n++ {
+		if _, err := ts.hub.Broadcast(roomID, testMessage{N: n}); err != nil {
+			t.Fatalf("broadcasting %d: %v", n, err)
+		}
+	}
+}
+
+// readMessages - reads the next count messages of the connection and returns
+// their numbers
+func readMessages(t *testing.T, conn *websocket.Conn, count int) []int {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(waitTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	numbers := []int{}
+	for len(numbers) < count {
+		var msg testMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read %v, then: %v", numbers, err)
+		}
+		numbers = append(numbers, msg.N)
+	}
+
+	return numbers
+}
+
+// expectMessages - reads the messages of the connection, failing the test
+// unless their numbers are want
+func expectMessages(t *testing.T, conn *websocket.Conn, want ...int) {
+	t.Helper()
+
+	got := readMessages(t, conn, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got messages %v, want %v", got, want)
+		}
+	}
+}
+
+// expectClose - reads the connection until it is closed, failing the test
+// unless the close code is code
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(waitTimeout))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, code) {
+			t.Fatalf("connection closed with %v, want close code %d", err, code)
+		}
+		return
+	}
+}
+
+// TestHeartbeatReapsSilentClients - a client that stops answering the pings
+// is disconnected after PongWait and counted as reaped, the ones answering
+// stay connected
+func TestHeartbeatReapsSilentClients(t *testing.T) {
+
+	config := testConfig()
+	config.PingInterval = 20 * time.Millisecond
+	config.PongWait = 60 * time.Millisecond
+
+	ts := newTestServer(t, config)
+
+	alive := ts.dial(t, "room", "alive")
+	aliveErrs := readLoop(alive)
+
+	silent := ts.dial(t, "room", "silent")
+	silent.SetPingHandler(func(string) error { return nil })
+	silentErrs := readLoop(silent)
+
+	select {
+	case err := <-silentErrs:
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("silent client closed with %v, want a going away close frame", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("silent client was not disconnected")
+	}
+
+	waitFor(t, "the silent client to leave", func() bool { return ts.hub.Stats().Clients == 1 })
+
+	//the client answering the pings outlives several pong waits
+	select {
+	case err := <-aliveErrs:
+		t.Fatalf("alive client disconnected: %v", err)
+	case <-time.After(5 * config.PongWait):
+	}
+
+	if stats := ts.hub.Stats(); stats.Clients != 1 || stats.Reaped != 1 {
+		t.Fatalf("hub has %d clients and reaped %d, want 1 and 1", stats.Clients, stats.Reaped)
+	}
+}
+
+// TestReadDeadlineUnblocksReader - the read of a connection that got no pong
+// for PongWait fails by itself, without waiting for the reaper
+func TestReadDeadlineUnblocksReader(t *testing.T) {
+
+	//no ping nor reaping during the test
+	config := testConfig()
+	config.PingInterval = time.Hour
+	config.PongWait = 50 * time.Millisecond
+
+	ts := newTestServer(t, config)
+	conn := ts.dial(t, "room", "silent")
+	errs := readLoop(conn)
+
+	select {
+	case err := <-ts.readErrs:
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("read failed with %v, want a timeout", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("read of the silent connection did not time out")
+	}
+
+	if err := <-errs; !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("client closed with %v, want a going away close frame", err)
+	}
+
+	waitFor(t, "the client to leave", func() bool { return ts.hub.Stats().Clients == 0 })
+	if reaped := ts.hub.Stats().Reaped; reaped != 1 {
+		t.Fatalf("hub reaped %d clients, want 1", reaped)
+	}
+}
+
+// TestOverflowDropOldest - a slow client loses its oldest queued messages, the
+// other clients get every message without waiting for it
+func TestOverflowDropOldest(t *testing.T) {
+
+	config := testConfig()
+	config.SendQueueSize = 2
+	config.OverflowPolicy = OverflowDropOldest
+
+	ts := newTestServer(t, config)
+	fast := ts.dial(t, "room", "fast")
+	slow := ts.dialSlow(t, "room", "slow")
+	waitFor(t, "the clients to join", func() bool { return ts.hub.Stats().Clients == 2 })
+
+	for n := 0; n < 5; n++ {
+		ts.broadcast(t, "room", n, n+1)
+		expectMessages(t, fast, n)
+	}
+
+	if dropped := ts.hub.Stats().Dropped; dropped != 3 {
+		t.Fatalf("hub dropped %d messages, want 3", dropped)
+	}
+
+	ts.resumeSlow()
+	expectMessages(t, slow, 3, 4)
+
+	if stats := ts.hub.Stats(); stats.Clients != 2 || stats.SlowDisconnected != 0 {
+		t.Fatalf("hub has %d clients and disconnected %d, want 2 and 0", stats.Clients, stats.SlowDisconnected)
+	}
+}
+
+// TestOverflowDisconnect - a slow client is closed once its queue is full, the
+// other clients get every message without waiting for it
+func TestOverflowDisconnect(t *testing.T) {
+
+	config := testConfig()
+	config.SendQueueSize = 2
+	config.OverflowPolicy = OverflowDisconnect
+
+	ts := newTestServer(t, config)
+	fast := ts.dial(t, "room", "fast")
+	slow := ts.dialSlow(t, "room", "slow")
+	waitFor(t, "the clients to join", func() bool { return ts.hub.Stats().Clients == 2 })
+
+	for n := 0; n < 3; n++ {
+		ts.broadcast(t, "room", n, n+1)
+		expectMessages(t, fast, n)
+	}
+
+	if disconnected := ts.hub.Stats().SlowDisconnected; disconnected != 1 {
+		t.Fatalf("hub disconnected %d clients, want 1", disconnected)
+	}
+
+	//the queued messages are still written before the close frame
+	ts.resumeSlow()
+	expectMessages(t, slow, 0, 1)
+	expectClose(t, slow, websocket.CloseTryAgainLater)
+
+	waitFor(t, "the slow client to leave", func() bool { return ts.hub.Stats().Clients == 1 })
+	ts.broadcast(t, "room", 3, 4)
+	expectMessages(t, fast, 3)
+}
+
+// TestOverflowBlock - the room waits up to OverflowTimeout for a slow client
+// to make room in its queue, then closes it. The other clients get the message
+// meanwhile.
+func TestOverflowBlock(t *testing.T) {
+
+	t.Run("timeout", func(t *testing.T) {
+
+		config := testConfig()
+		config.SendQueueSize = 1
+		config.OverflowPolicy = OverflowBlock
+		config.OverflowTimeout = 500 * time.Millisecond
+
+		ts := newTestServer(t, config)
+		fast := ts.dial(t, "room", "fast")
+		slow := ts.dialSlow(t, "room", "slow")
+		waitFor(t, "the clients to join", func() bool { return ts.hub.Stats().Clients == 2 })
+
+		ts.broadcast(t, "room", 0, 1)
+		expectMessages(t, fast, 0)
+
+		start := time.Now()
+		ts.broadcast(t, "room", 1, 2)
+		expectMessages(t, fast, 1)
+		if elapsed := time.Since(start); elapsed >= config.OverflowTimeout {
+			t.Fatalf("fast client waited %s for the slow one", elapsed)
+		}
+
+		waitFor(t, "the slow client to be disconnected", func() bool { return ts.hub.Stats().SlowDisconnected == 1 })
+		if elapsed := time.Since(start); elapsed < config.OverflowTimeout {
+			t.Fatalf("slow client disconnected after %s, want at least %s", elapsed, config.OverflowTimeout)
+		}
+
+		ts.resumeSlow()
+		expectMessages(t, slow, 0)
+		expectClose(t, slow, websocket.CloseTryAgainLater)
+	})
+
+	t.Run("room made in time", func(t *testing.T) {
+
+		config := testConfig()
+		config.SendQueueSize = 1
+		config.OverflowPolicy = OverflowBlock
+		config.OverflowTimeout = time.Minute
+
+		ts := newTestServer(t, config)
+		fast := ts.dial(t, "room", "fast")
+		slow := ts.dialSlow(t, "room", "slow")
+		waitFor(t, "the clients to join", func() bool { return ts.hub.Stats().Clients == 2 })
+
+		ts.broadcast(t, "room", 0, 2)
+		expectMessages(t, fast, 0, 1)
+
+		ts.resumeSlow()
+		expectMessages(t, slow, 0, 1)
+
+		if stats := ts.hub.Stats(); stats.Clients != 2 || stats.SlowDisconnected != 0 {
+			t.Fatalf("hub has %d clients and disconnected %d, want 2 and 0", stats.Clients, stats.SlowDisconnected)
+		}
+	})
+}
+
+// TestJoinLeave - the hub counts the clients of each user, a user is online
+// from the join of its first client to the leave of its last one
+func TestJoinLeave(t *testing.T) {
+
+	hub := NewHub(testConfig())
+	alice1 := NewClient(serverConn(t), "alice")
+	alice2 := NewClient(serverConn(t), "alice")
+	bob := NewClient(serverConn(t), "bob")
+
+	room, first := hub.Join("room", alice1)
+	if !first {
+		t.Fatal("first client of alice did not bring alice online")
+	}
+	if room2, first := hub.Join("room", alice2); first || room2 != room {
+		t.Fatalf("second client of alice: first %v, same room %v, want false and true", first, room2 == room)
+	}
+	if _, first := hub.Join("room", bob); !first {
+		t.Fatal("first client of bob did not bring bob online")
+	}
+
+	if online := hub.Online("room"); len(online) != 2 || online[0] != "alice" || online[1] != "bob" {
+		t.Fatalf("online users %v, want [alice bob]", online)
+	}
+	if stats := hub.Stats(); stats.Rooms != 1 || stats.Clients != 3 {
+		t.Fatalf("hub has %d rooms and %d clients, want 1 and 3", stats.Rooms, stats.Clients)
+	}
+
+	if last := hub.Leave(alice1); last {
+		t.Fatal("alice went offline with a client left")
+	}
+	if last := hub.Leave(alice2); !last {
+		t.Fatal("alice stayed online without clients")
+	}
+	if online := hub.Online("room"); len(online) != 1 || online[0] != "bob" {
+		t.Fatalf("online users %v, want [bob]", online)
+	}
+
+	//a client leaves once, the send queue is closed by the room
+	if last := hub.Leave(alice2); last {
+		t.Fatal("second leave of a client reported the user offline")
+	}
+	if _, ok := <-alice2.send; ok {
+		t.Fatal("send queue of a client that left is still open")
+	}
+	if stats := hub.Stats(); stats.Clients != 1 {
+		t.Fatalf("hub has %d clients, want 1", stats.Clients)
+	}
+}
+
+// TestRoomTornDownWithLastClient - the room stops once its last client left,
+// the next client starts a new one
+func TestRoomTornDownWithLastClient(t *testing.T) {
+
+	hub := NewHub(testConfig())
+	alice := NewClient(serverConn(t), "alice")
+	bob := NewClient(serverConn(t), "bob")
+
+	room, _ := hub.Join("room", alice)
+	hub.Join("other", bob)
+	if count := hub.RoomCount(); count != 2 {
+		t.Fatalf("hub has %d rooms, want 2", count)
+	}
+
+	hub.Leave(alice)
+
+	select {
+	case <-room.stop:
+	default:
+		t.Fatal("room without clients was not stopped")
+	}
+	if count := hub.RoomCount(); count != 1 {
+		t.Fatalf("hub has %d rooms, want 1", count)
+	}
+	if online := hub.Online("room"); len(online) != 0 {
+		t.Fatalf("online users of a stopped room %v, want none", online)
+	}
+
+	//messages for the stopped room are dropped instead of blocking
+	if sent, err := hub.Broadcast("room", testMessage{}); sent || err != nil {
+		t.Fatalf("broadcast to a stopped room: %v, %v, want false and no error", sent, err)
+	}
+	if err := room.Broadcast(testMessage{}); err != nil {
+		t.Fatalf("broadcast through a stopped room: %v", err)
+	}
+
+	carol := NewClient(serverConn(t), "carol")
+	if room2, first := hub.Join("room", carol); room2 == room || !first {
+		t.Fatalf("join after teardown: new room %v, first %v, want true and true", room2 != room, first)
+	}
+	if count := hub.RoomCount(); count != 2 {
+		t.Fatalf("hub has %d rooms, want 2", count)
+	}
+}
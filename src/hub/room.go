@@ -0,0 +1,262 @@
+package hub
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"sync/atomic"
+	"time"
+)
+
+// Room - a single chat room, its client set is owned by the run goroutine and
+// only modified through the register and unregister channels
+type Room struct {
+	ID  string
+	hub *Hub
+
+	clients    map[*Client]bool
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan broadcastMessage
+	direct     chan directMessage
+	release    chan releaseRequest
+	stop       chan struct{}
+
+	//number of clients that joined through the hub and number of clients
+	//per user, guarded by hub.mu
+	refs   int
+	online map[string]int
+}
+
+// broadcastMessage - message for every client of the room but except, if set
+type broadcastMessage struct {
+	msg    outbound
+	except *Client
+}
+
+// directMessage - message for a single client of the room
+type directMessage struct {
+	client *Client
+	msg    outbound
+}
+
+// releaseRequest - request to stop holding the messages of a client, done is
+// closed once they are handed over
+type releaseRequest struct {
+	client *Client
+	done   chan struct{}
+}
+
+// newRoom - returns a room that is ready to run
+func newRoom(hub *Hub, id string) *Room {
+	return &Room{
+		ID:         id,
+		hub:        hub,
+		clients:    make(map[*Client]bool),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan broadcastMessage),
+		direct:     make(chan directMessage),
+		release:    make(chan releaseRequest),
+		stop:       make(chan struct{}),
+		online:     make(map[string]int),
+	}
+}
+
+// Broadcast - encodes v as JSON and sends it to every client of the room,
+// the message is dropped if the room has already been stopped
+func (room *Room) Broadcast(v interface{}) error {
+	return room.BroadcastSeq(0, v)
+}
+
+// BroadcastSeq - same as Broadcast for a message with a sequence number, clients
+// skip the sequence numbers they already received, see Client.MarkDelivered
+func (room *Room) BroadcastSeq(seq int64, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case room.broadcast <- broadcastMessage{msg: outbound{seq: seq, data: data}}:
+	case <-room.stop:
+	}
+
+	return nil
+}
+
+// BroadcastExcept - same as Broadcast without sending to the given client,
+// e.g. for events the sender does not need back
+func (room *Room) BroadcastExcept(client *Client, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case room.broadcast <- broadcastMessage{msg: outbound{data: data}, except: client}:
+	case <-room.stop:
+	}
+
+	return nil
+}
+
+// Send - encodes v as JSON and sends it to a single client of the room, the
+// message is dropped if the client already left
+func (room *Room) Send(client *Client, v interface{}) error {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case room.direct <- directMessage{client: client, msg: outbound{data: data}}:
+	case <-room.stop:
+	}
+
+	return nil
+}
+
+// Release - hands the messages kept aside for a client that called Hold over
+// to its WritePump, which must be started after Release returns. The client
+// must not have left the room.
+func (room *Room) Release(client *Client) {
+
+	done := make(chan struct{})
+	room.release <- releaseRequest{client: client, done: done}
+	<-done
+}
+
+// run - owns the client set, fans out messages and reaps stale clients until
+// the room is stopped
+func (room *Room) run() {
+
+	reaper := time.NewTicker(room.hub.config.PingInterval)
+	defer reaper.Stop()
+
+	for {
+		select {
+		case client := <-room.register:
+			room.clients[client] = true
+
+		case client := <-room.unregister:
+			if _, ok := room.clients[client]; ok {
+				//the read deadline expired before the reaper noticed
+				if time.Since(client.lastSeen()) > room.hub.config.PongWait {
+					client.SetCloseReason(websocket.CloseGoingAway, "ping timeout")
+					atomic.AddInt64(&room.hub.reaped, 1)
+				}
+				delete(room.clients, client)
+				close(client.send)
+			}
+
+		case broadcast := <-room.broadcast:
+			clients := make([]*Client, 0, len(room.clients))
+			for client := range room.clients {
+				if client != broadcast.except {
+					clients = append(clients, client)
+				}
+			}
+			room.deliver(broadcast.msg, clients)
+
+		case direct := <-room.direct:
+			if _, ok := room.clients[direct.client]; ok {
+				room.deliver(direct.msg, []*Client{direct.client})
+			}
+
+		case release := <-room.release:
+			release.client.held = false
+			close(release.done)
+
+		case now := <-reaper.C:
+			room.reap(now)
+
+		case <-room.stop:
+			return
+		}
+	}
+}
+
+// deliver - queues the message for the clients, keeping it aside for the held
+// ones and applying the overflow policy to the ones whose queue is full. The
+// clients with room in their queue get the message first so that a slow client
+// does not delay them, the slow ones share a single OverflowTimeout.
+func (room *Room) deliver(msg outbound, clients []*Client) {
+
+	var full []*Client
+	for _, client := range clients {
+		if client.held {
+			client.pending = append(client.pending, msg)
+			continue
+		}
+
+		select {
+		case client.send <- msg:
+		default:
+			full = append(full, client)
+		}
+	}
+
+	deadline := time.Now().Add(room.hub.config.OverflowTimeout)
+	for _, client := range full {
+		room.overflow(client, msg, deadline)
+	}
+}
+
+// overflow - applies the overflow policy to a client whose queue is full, the
+// block policy waits until the deadline at most
+func (room *Room) overflow(client *Client, msg outbound, deadline time.Time) {
+
+	switch room.hub.config.OverflowPolicy {
+	case OverflowDropOldest:
+		//make room by dropping the oldest message, the writer may have
+		//made room meanwhile
+		select {
+		case <-client.send:
+			atomic.AddInt64(&room.hub.dropped, 1)
+		default:
+		}
+		select {
+		case client.send <- msg:
+			return
+		default:
+			atomic.AddInt64(&room.hub.dropped, 1)
+			return
+		}
+
+	case OverflowBlock:
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+
+		select {
+		case client.send <- msg:
+			return
+		case <-timer.C:
+		}
+	}
+
+	//client is not keeping up, drop it
+	client.SetCloseReason(websocket.CloseTryAgainLater, "client is too slow")
+	delete(room.clients, client)
+	close(client.send)
+	atomic.AddInt64(&room.hub.slowDisconnected, 1)
+}
+
+// reap - closes the clients that did not answer the pings within PongWait,
+// the reader of the connection then fails and the client leaves the room. The
+// read deadline set by Client.touch may notice them first, they are counted
+// as reaped when they leave.
+func (room *Room) reap(now time.Time) {
+	for client := range room.clients {
+		if now.Sub(client.lastSeen()) <= room.hub.config.PongWait {
+			continue
+		}
+
+		client.SetCloseReason(websocket.CloseGoingAway, "ping timeout")
+		delete(room.clients, client)
+		close(client.send)
+		atomic.AddInt64(&room.hub.reaped, 1)
+	}
+}
@@ -1,13 +1,32 @@
 package model
 
 import (
+	"encoding/json"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ChatRoomTypeDirect - type of the chat rooms of a direct conversation
+// between two users
+const ChatRoomTypeDirect = "direct"
+
+// Chat room visibilities, chat rooms without visibility are public
+const (
+	// ChatRoomPublic - listed to everyone and joined freely
+	ChatRoomPublic = "public"
+	// ChatRoomPrivate - only listed to its members and joined by invitation
+	ChatRoomPrivate = "private"
 )
 
 // ChatRoom model
 type ChatRoom struct {
-	ID   primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Name string             `json:"name,omitempty" bson:"name,omitempty"`
+	ID         primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name       string               `json:"name,omitempty" bson:"name,omitempty"`
+	Type       string               `json:"type,omitempty" bson:"type,omitempty"`
+	Visibility string               `json:"visibility,omitempty" bson:"visibility,omitempty"`
+	Members    []primitive.ObjectID `json:"members,omitempty" bson:"members,omitempty"`
+	//unique key of the pair of users of a direct chat room
+	DirectKey string `json:"-" bson:"direct_key,omitempty"`
 }
 
 // User model
@@ -21,8 +40,153 @@ type User struct {
 
 // Message model
 type Message struct {
+	ID              primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	ChatRoomID      primitive.ObjectID  `json:"chatroom_id,omitempty" bson:"chatroom_id,omitempty"`
+	UserID          primitive.ObjectID  `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Body            string              `json:"body,omitempty" bson:"body,omitempty"`
+	ClientMessageID string              `json:"client_message_id,omitempty" bson:"client_message_id,omitempty"`
+	ParentID        *primitive.ObjectID `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	ReplyCount      int64               `json:"reply_count,omitempty" bson:"reply_count,omitempty"`
+	LastReplyAt     *time.Time          `json:"last_reply_at,omitempty" bson:"last_reply_at,omitempty"`
+	Seq             int64               `json:"seq,omitempty" bson:"seq,omitempty"`
+	CreatedAt       time.Time           `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	EditedAt        *time.Time          `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	Edits           []MessageEdit       `json:"edits,omitempty" bson:"edits,omitempty"`
+	Deleted         bool                `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	DeletedAt       *time.Time          `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Reactions       []Reaction          `json:"-" bson:"reactions,omitempty"`
+}
+
+// MarshalJSON - encodes the message with its reactions counted per emoji
+func (message Message) MarshalJSON() ([]byte, error) {
+
+	//plain has the fields of Message without its methods
+	type plain Message
+
+	return json.Marshal(struct {
+		plain
+		Reactions []ReactionCount `json:"reactions,omitempty"`
+	}{
+		plain:     plain(message),
+		Reactions: CountReactions(message.Reactions),
+	})
+}
+
+// MessageEdit model, previous body of an edited message and when it was written
+type MessageEdit struct {
+	Body      string    `json:"body" bson:"body"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Reaction model, emoji added to a message by a user
+type Reaction struct {
+	Emoji  string             `json:"emoji" bson:"emoji"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+}
+
+// ReactionCount model, users that reacted to a message with the same emoji
+type ReactionCount struct {
+	Emoji   string               `json:"emoji"`
+	Count   int64                `json:"count"`
+	UserIDs []primitive.ObjectID `json:"user_ids"`
+}
+
+// CountReactions - groups the reactions by emoji in the order the emojis were
+// first used
+func CountReactions(reactions []Reaction) []ReactionCount {
+
+	var counts []ReactionCount
+	index := make(map[string]int)
+
+	for _, reaction := range reactions {
+		i, ok := index[reaction.Emoji]
+		if !ok {
+			i = len(counts)
+			index[reaction.Emoji] = i
+			counts = append(counts, ReactionCount{Emoji: reaction.Emoji})
+		}
+		counts[i].Count++
+		counts[i].UserIDs = append(counts[i].UserIDs, reaction.UserID)
+	}
+
+	return counts
+}
+
+// Membership roles
+const (
+	// RoleOwner - created the chat room, can rename and delete it and
+	// change the roles of the members
+	RoleOwner = "owner"
+	// RoleAdmin - can rename and delete the chat room
+	RoleAdmin = "admin"
+	// RoleMember - can post in the chat room
+	RoleMember = "member"
+)
+
+// Membership model, role of a user in a chat room
+type Membership struct {
+	ChatRoomID primitive.ObjectID `json:"chatroom_id,omitempty" bson:"chatroom_id,omitempty"`
+	UserID     primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Role       string             `json:"role,omitempty" bson:"role,omitempty"`
+	JoinedAt   time.Time          `json:"joined_at,omitempty" bson:"joined_at,omitempty"`
+}
+
+// Invitation statuses
+const (
+	// InvitationPending - waiting for the answer of the invited user
+	InvitationPending = "pending"
+	// InvitationAccepted - the invited user joined the chat room
+	InvitationAccepted = "accepted"
+	// InvitationDeclined - the invited user declined to join the chat room
+	InvitationDeclined = "declined"
+)
+
+// Invitation model, invitation of a user to join a chat room
+type Invitation struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	ChatRoomID  primitive.ObjectID `json:"chatroom_id,omitempty" bson:"chatroom_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	InvitedBy   primitive.ObjectID `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	Status      string             `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt   time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	RespondedAt *time.Time         `json:"responded_at,omitempty" bson:"responded_at,omitempty"`
+}
+
+// InviteLink model, shareable code joining a chat room until it expires, is
+// used up or is revoked
+type InviteLink struct {
 	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	ChatRoomID primitive.ObjectID `json:"chatroom_id,omitempty" bson:"chatroom_id,omitempty"`
+	Code       string             `json:"code,omitempty" bson:"code,omitempty"`
+	CreatedBy  primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt  time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	//no expiry when nil
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	//no limit when 0
+	MaxUses   int64      `json:"max_uses,omitempty" bson:"max_uses,omitempty"`
+	Uses      int64      `json:"uses" bson:"uses"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// Active - the invite link can still be redeemed at the given time
+func (link InviteLink) Active(now time.Time) bool {
+
+	if link.RevokedAt != nil {
+		return false
+	}
+
+	if link.ExpiresAt != nil && !now.Before(*link.ExpiresAt) {
+		return false
+	}
+
+	return link.MaxUses == 0 || link.Uses < link.MaxUses
+}
+
+// ReadMarker model, last message of a chat room read by a user
+type ReadMarker struct {
 	ChatRoomID primitive.ObjectID `json:"chatroom_id,omitempty" bson:"chatroom_id,omitempty"`
 	UserID     primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
-	Body       string             `json:"body,omitempty" bson:"body,omitempty"`
+	MessageID  primitive.ObjectID `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	Seq        int64              `json:"seq,omitempty" bson:"seq,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
 }
@@ -0,0 +1,432 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Version - version of the websocket protocol spoken by the server
+const Version = 1
+
+// Event kinds carried by the envelope
+const (
+	// TypeMessage - chat message, sent by clients and broadcast by the server
+	TypeMessage = "message"
+	// TypeAck - confirms to the sender that its frame was processed
+	TypeAck = "ack"
+	// TypeError - reports a problem with a frame or the connection
+	TypeError = "error"
+	// TypeSystem - notice generated by the server
+	TypeSystem = "system"
+	// TypePresence - a user joined or left the room
+	TypePresence = "presence"
+	// TypeTyping - a user started or stopped typing, never stored
+	TypeTyping = "typing"
+	// TypeRead - a user read the room up to a message
+	TypeRead = "read"
+	// TypeEdit - the author changed the body of a message
+	TypeEdit = "edit"
+	// TypeDelete - the author deleted a message
+	TypeDelete = "delete"
+	// TypeThread - the replies of a message changed
+	TypeThread = "thread"
+	// TypeReaction - a user added or removed an emoji reaction to a message
+	TypeReaction = "reaction"
+)
+
+// Presence statuses
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+// Error codes of the error frames
+const (
+	// ErrorCodeInvalidFrame - frame is not a valid envelope or its payload does not match its type
+	ErrorCodeInvalidFrame = "invalid_frame"
+	// ErrorCodeUnsupportedVersion - frame uses a protocol version the server does not speak
+	ErrorCodeUnsupportedVersion = "unsupported_version"
+	// ErrorCodeUnknownType - frame type is not one of the event kinds
+	ErrorCodeUnknownType = "unknown_type"
+	// ErrorCodeTypeNotAllowed - frame type can only be sent by the server
+	ErrorCodeTypeNotAllowed = "type_not_allowed"
+	// ErrorCodeRoomMismatch - frame is addressed to another room than the one of the connection
+	ErrorCodeRoomMismatch = "room_mismatch"
+	// ErrorCodeNotFound - frame refers to a message that does not exist in the room
+	ErrorCodeNotFound = "not_found"
+	// ErrorCodeForbidden - user is not allowed to do what the frame asks
+	ErrorCodeForbidden = "forbidden"
+	// ErrorCodeInternal - server failed to process the frame, it can be retried
+	ErrorCodeInternal = "internal_error"
+)
+
+// Typing statuses
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// Reaction actions
+const (
+	ReactionAdd    = "add"
+	ReactionRemove = "remove"
+)
+
+// MaxEmojiLength - maximum number of characters of a reaction emoji
+const MaxEmojiLength = 16
+
+// MaxBodyLength - maximum number of characters of a chat message
+const MaxBodyLength = 4096
+
+// MaxClientMessageIDLength - maximum length of a client message id
+const MaxClientMessageIDLength = 128
+
+// ErrUnsupportedVersion - frame uses a protocol version the server does not speak
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// ErrUnknownType - frame type is not one of the event kinds
+var ErrUnknownType = errors.New("unknown frame type")
+
+// ErrInvalidPayload - payload does not match its frame type
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// ErrRoomMismatch - frame is addressed to another room than the one of the connection
+var ErrRoomMismatch = errors.New("room_id does not match the room of the connection")
+
+// Envelope - every frame exchanged over the websocket
+type Envelope struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	// correlation id chosen by the sender of the frame
+	ID      string          `json:"id,omitempty"`
+	RoomID  string          `json:"room_id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+}
+
+// CheckRoom - frames without room id belong to the room of the connection,
+// the others must name it
+func (envelope Envelope) CheckRoom(roomID string) error {
+	if envelope.RoomID != "" && envelope.RoomID != roomID {
+		return ErrRoomMismatch
+	}
+	return nil
+}
+
+// Payload - content of a frame, validated when decoded
+type Payload interface {
+	Validate() error
+}
+
+// MessagePayload - chat message, clients only send the body, the server
+// broadcasts the message as it was stored
+type MessagePayload struct {
+	ID     string `json:"_id,omitempty"`
+	RoomID string `json:"chatroom_id,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	// id generated by the client, resending a message with the same id
+	// returns the stored message instead of creating a new one
+	ClientMessageID string `json:"client_message_id,omitempty"`
+	// id of the message replied to, a reply to a reply joins the thread
+	// of the message that started it
+	ParentID    string          `json:"parent_id,omitempty"`
+	Body        string          `json:"body"`
+	Seq         int64           `json:"seq,omitempty"`
+	CreatedAt   *time.Time      `json:"created_at,omitempty"`
+	EditedAt    *time.Time      `json:"edited_at,omitempty"`
+	Deleted     bool            `json:"deleted,omitempty"`
+	ReplyCount  int64           `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time      `json:"last_reply_at,omitempty"`
+	Reactions   []ReactionCount `json:"reactions,omitempty"`
+}
+
+// ReactionCount - users that reacted to a message with the same emoji
+type ReactionCount struct {
+	Emoji   string   `json:"emoji"`
+	Count   int64    `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// Validate - body must not be blank nor too long
+func (payload *MessagePayload) Validate() error {
+	if err := ValidateBody(payload.Body); err != nil {
+		return err
+	}
+	if len(payload.ClientMessageID) > MaxClientMessageIDLength {
+		return fmt.Errorf("client_message_id is longer than %d characters", MaxClientMessageIDLength)
+	}
+	return nil
+}
+
+// ValidateBody - body of a chat message must not be blank nor too long
+func ValidateBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("body is required")
+	}
+	if utf8.RuneCountInString(body) > MaxBodyLength {
+		return fmt.Errorf("body is longer than %d characters", MaxBodyLength)
+	}
+	return nil
+}
+
+// AckPayload - acknowledgement of the frame with the same envelope id
+type AckPayload struct {
+	MessageID string `json:"message_id,omitempty"`
+	// true when the message had already been stored by a previous frame
+	Duplicate bool       `json:"duplicate,omitempty"`
+	Seq       int64      `json:"seq,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Validate - acks carry no mandatory field
+func (payload *AckPayload) Validate() error {
+	return nil
+}
+
+// ErrorPayload - error reported for the frame with the same envelope id
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// Validate - code is required
+func (payload *ErrorPayload) Validate() error {
+	if payload.Code == "" {
+		return errors.New("code is required")
+	}
+	return nil
+}
+
+// System events
+const (
+	// SystemEventReplayComplete - every missed message was replayed, live delivery follows
+	SystemEventReplayComplete = "replay_complete"
+)
+
+// SystemPayload - notice generated by the server
+type SystemPayload struct {
+	Event string `json:"event,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// Validate - event or text is required
+func (payload *SystemPayload) Validate() error {
+	if payload.Event == "" && payload.Text == "" {
+		return errors.New("event or text is required")
+	}
+	return nil
+}
+
+// PresencePayload - a user joined or left the room
+type PresencePayload struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
+// Validate - user id is required and status must be join or leave
+func (payload *PresencePayload) Validate() error {
+	if payload.UserID == "" {
+		return errors.New("user_id is required")
+	}
+	if payload.Status != PresenceJoin && payload.Status != PresenceLeave {
+		return fmt.Errorf("status must be %q or %q", PresenceJoin, PresenceLeave)
+	}
+	return nil
+}
+
+// TypingPayload - a user started or stopped typing, clients only send the
+// status, the server adds the user
+type TypingPayload struct {
+	UserID string `json:"user_id,omitempty"`
+	Status string `json:"status"`
+}
+
+// Validate - status must be start or stop
+func (payload *TypingPayload) Validate() error {
+	if payload.Status != TypingStart && payload.Status != TypingStop {
+		return fmt.Errorf("status must be %q or %q", TypingStart, TypingStop)
+	}
+	return nil
+}
+
+// ReadPayload - a user read the room up to a message, clients send either the
+// message id or its sequence number, the server broadcasts the receipt with
+// the user and both
+type ReadPayload struct {
+	UserID    string     `json:"user_id,omitempty"`
+	MessageID string     `json:"message_id,omitempty"`
+	Seq       int64      `json:"seq,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+// Validate - message id or sequence number is required
+func (payload *ReadPayload) Validate() error {
+	if payload.MessageID == "" && payload.Seq <= 0 {
+		return errors.New("message_id or seq is required")
+	}
+	return nil
+}
+
+// EditPayload - the author changed the body of a message, clients send the
+// message id and the new body, the server broadcasts it with the edit time
+type EditPayload struct {
+	MessageID string     `json:"message_id"`
+	Body      string     `json:"body"`
+	Seq       int64      `json:"seq,omitempty"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+}
+
+// Validate - message id is required and body must not be blank nor too long
+func (payload *EditPayload) Validate() error {
+	if payload.MessageID == "" {
+		return errors.New("message_id is required")
+	}
+	return ValidateBody(payload.Body)
+}
+
+// DeletePayload - the author deleted a message, clients send the message id,
+// the server broadcasts it with the deletion time
+type DeletePayload struct {
+	MessageID string     `json:"message_id"`
+	Seq       int64      `json:"seq,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Validate - message id is required
+func (payload *DeletePayload) Validate() error {
+	if payload.MessageID == "" {
+		return errors.New("message_id is required")
+	}
+	return nil
+}
+
+// ThreadPayload - the replies of a message changed, sent by the server only
+type ThreadPayload struct {
+	MessageID   string     `json:"message_id"`
+	ReplyCount  int64      `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+}
+
+// Validate - message id is required
+func (payload *ThreadPayload) Validate() error {
+	if payload.MessageID == "" {
+		return errors.New("message_id is required")
+	}
+	return nil
+}
+
+// ReactionPayload - a user added or removed an emoji reaction to a message,
+// clients send the message id, the emoji and the action, the server broadcasts
+// it with the user and the new number of reactions with the emoji
+type ReactionPayload struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Action    string `json:"action"`
+	UserID    string `json:"user_id,omitempty"`
+	Count     int64  `json:"count"`
+}
+
+// Validate - message id is required, emoji must be valid and action must be
+// add or remove
+func (payload *ReactionPayload) Validate() error {
+	if payload.MessageID == "" {
+		return errors.New("message_id is required")
+	}
+	if payload.Action != ReactionAdd && payload.Action != ReactionRemove {
+		return fmt.Errorf("action must be %q or %q", ReactionAdd, ReactionRemove)
+	}
+	return ValidateEmoji(payload.Emoji)
+}
+
+// ValidateEmoji - emoji of a reaction must not be empty nor too long and can not
+// contain spaces or control characters
+func ValidateEmoji(emoji string) error {
+	if emoji == "" {
+		return errors.New("emoji is required")
+	}
+	if utf8.RuneCountInString(emoji) > MaxEmojiLength {
+		return fmt.Errorf("emoji is longer than %d characters", MaxEmojiLength)
+	}
+	for _, r := range emoji {
+		if r == utf8.RuneError || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return errors.New("emoji contains invalid characters")
+		}
+	}
+	return nil
+}
+
+// payloadTypes - returns an empty payload for every frame type
+var payloadTypes = map[string]func() Payload{
+	TypeMessage:  func() Payload { return &MessagePayload{} },
+	TypeAck:      func() Payload { return &AckPayload{} },
+	TypeError:    func() Payload { return &ErrorPayload{} },
+	TypeSystem:   func() Payload { return &SystemPayload{} },
+	TypePresence: func() Payload { return &PresencePayload{} },
+	TypeTyping:   func() Payload { return &TypingPayload{} },
+	TypeRead:     func() Payload { return &ReadPayload{} },
+	TypeEdit:     func() Payload { return &EditPayload{} },
+	TypeDelete:   func() Payload { return &DeletePayload{} },
+	TypeThread:   func() Payload { return &ThreadPayload{} },
+	TypeReaction: func() Payload { return &ReactionPayload{} },
+}
+
+// Decode - parses a frame and validates its payload against its type
+func Decode(data []byte) (Envelope, Payload, error) {
+
+	var envelope Envelope
+
+	err := json.Unmarshal(data, &envelope)
+	if err != nil {
+		return envelope, nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	if envelope.Version != Version {
+		return envelope, nil, ErrUnsupportedVersion
+	}
+
+	newPayload, ok := payloadTypes[envelope.Type]
+	if !ok {
+		return envelope, nil, ErrUnknownType
+	}
+
+	payload := newPayload()
+	if len(envelope.Payload) == 0 {
+		return envelope, nil, fmt.Errorf("%w: payload is required", ErrInvalidPayload)
+	}
+
+	err = json.Unmarshal(envelope.Payload, payload)
+	if err != nil {
+		return envelope, nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	err = payload.Validate()
+	if err != nil {
+		return envelope, nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	return envelope, payload, nil
+}
+
+// NewEnvelope - builds a frame of the given type around the payload
+func NewEnvelope(frameType string, id string, roomID string, payload Payload) (Envelope, error) {
+
+	envelope := Envelope{
+		Version: Version,
+		Type:    frameType,
+		ID:      id,
+		RoomID:  roomID,
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return envelope, err
+	}
+
+	envelope.Payload = raw
+
+	return envelope, nil
+}
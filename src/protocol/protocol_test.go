@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// frame - encodes an envelope of the given version and type around the raw
+// payload, left out when empty
+func frame(version int, frameType string, payload string) []byte {
+
+	envelope := Envelope{Version: version, Type: frameType, ID: "id", RoomID: "room"}
+	if payload != "" {
+		envelope.Payload = json.RawMessage(payload)
+	}
+
+	data, _ := json.Marshal(envelope)
+	return data
+}
+
+func TestDecode(t *testing.T) {
+
+	tests := []struct {
+		frameType string
+		payload   string
+		want      Payload
+	}{
+		{TypeMessage, `{"body":"hello","client_message_id":"c1"}`, &MessagePayload{Body: "hello", ClientMessageID: "c1"}},
+		{TypeAck, `{"message_id":"m1","seq":2}`, &AckPayload{MessageID: "m1", Seq: 2}},
+		{TypeError, `{"code":"forbidden"}`, &ErrorPayload{Code: ErrorCodeForbidden}},
+		{TypeSystem, `{"event":"replay_complete"}`, &SystemPayload{Event: SystemEventReplayComplete}},
+		{TypePresence, `{"user_id":"u1","status":"join"}`, &PresencePayload{UserID: "u1", Status: PresenceJoin}},
+		{TypeTyping, `{"status":"start"}`, &TypingPayload{Status: TypingStart}},
+		{TypeRead, `{"seq":3}`, &ReadPayload{Seq: 3}},
+		{TypeEdit, `{"message_id":"m1","body":"edited"}`, &EditPayload{MessageID: "m1", Body: "edited"}},
+		{TypeDelete, `{"message_id":"m1"}`, &DeletePayload{MessageID: "m1"}},
+		{TypeThread, `{"message_id":"m1","reply_count":2}`, &ThreadPayload{MessageID: "m1", ReplyCount: 2}},
+		{TypeReaction, `{"message_id":"m1","emoji":"👍","action":"add"}`, &ReactionPayload{MessageID: "m1", Emoji: "👍", Action: ReactionAdd}},
+	}
+
+	for _, test := range tests {
+		envelope, payload, err := Decode(frame(Version, test.frameType, test.payload))
+		if err != nil {
+			t.Errorf("%s: %v", test.frameType, err)
+			continue
+		}
+		if envelope.Type != test.frameType || envelope.ID != "id" || envelope.RoomID != "room" {
+			t.Errorf("%s: got envelope %+v", test.frameType, envelope)
+		}
+		if !reflect.DeepEqual(payload, test.want) {
+			t.Errorf("%s: got payload %+v, want %+v", test.frameType, payload, test.want)
+		}
+	}
+}
+
+func TestDecodeInvalidFrame(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not json", []byte("hello"), ErrInvalidPayload},
+		{"no version", frame(0, TypeMessage, `{"body":"hello"}`), ErrUnsupportedVersion},
+		{"newer version", frame(Version+1, TypeMessage, `{"body":"hello"}`), ErrUnsupportedVersion},
+		{"no type", frame(Version, "", `{"body":"hello"}`), ErrUnknownType},
+		{"unknown type", frame(Version, "shout", `{"body":"hello"}`), ErrUnknownType},
+		{"no payload", frame(Version, TypeMessage, ""), ErrInvalidPayload},
+		{"payload not an object", frame(Version, TypeMessage, `"hello"`), ErrInvalidPayload},
+		{"field of the wrong type", frame(Version, TypeMessage, `{"body":1}`), ErrInvalidPayload},
+	}
+
+	for _, test := range tests {
+		if _, _, err := Decode(test.data); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDecodeInvalidPayload(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		frameType string
+		payload   string
+	}{
+		{"blank body", TypeMessage, `{"body":"  "}`},
+		{"body too long", TypeMessage, `{"body":"` + strings.Repeat("a", MaxBodyLength+1) + `"}`},
+		{"client message id too long", TypeMessage, `{"body":"hello","client_message_id":"` + strings.Repeat("c", MaxClientMessageIDLength+1) + `"}`},
+		{"error without code", TypeError, `{"message":"oops"}`},
+		{"empty system notice", TypeSystem, `{}`},
+		{"presence without user", TypePresence, `{"status":"join"}`},
+		{"unknown presence status", TypePresence, `{"user_id":"u1","status":"away"}`},
+		{"unknown typing status", TypeTyping, `{"status":"thinking"}`},
+		{"read without message", TypeRead, `{}`},
+		{"read of a negative seq", TypeRead, `{"seq":-1}`},
+		{"edit without message", TypeEdit, `{"body":"edited"}`},
+		{"edit to a blank body", TypeEdit, `{"message_id":"m1","body":""}`},
+		{"delete without message", TypeDelete, `{}`},
+		{"thread without message", TypeThread, `{"reply_count":1}`},
+		{"reaction without message", TypeReaction, `{"emoji":"👍","action":"add"}`},
+		{"unknown reaction action", TypeReaction, `{"message_id":"m1","emoji":"👍","action":"toggle"}`},
+		{"reaction without emoji", TypeReaction, `{"message_id":"m1","action":"add"}`},
+		{"emoji with a space", TypeReaction, `{"message_id":"m1","emoji":"a b","action":"add"}`},
+		{"emoji too long", TypeReaction, `{"message_id":"m1","emoji":"` + strings.Repeat("x", MaxEmojiLength+1) + `","action":"add"}`},
+	}
+
+	for _, test := range tests {
+		if _, _, err := Decode(frame(Version, test.frameType, test.payload)); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidPayload)
+		}
+	}
+}
+
+func TestNewEnvelopeDecodes(t *testing.T) {
+
+	envelope, err := NewEnvelope(TypeMessage, "id", "room", &MessagePayload{Body: "hello", Seq: 1})
+	if err != nil {
+		t.Fatalf("building envelope: %v", err)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("encoding envelope: %v", err)
+	}
+
+	decoded, payload, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decoding envelope: %v", err)
+	}
+	if decoded.Version != Version || decoded.Type != TypeMessage || decoded.ID != "id" || decoded.RoomID != "room" {
+		t.Fatalf("got envelope %+v", decoded)
+	}
+	if message := payload.(*MessagePayload); message.Body != "hello" || message.Seq != 1 {
+		t.Fatalf("got payload %+v", message)
+	}
+}
+
+func TestCheckRoom(t *testing.T) {
+
+	tests := []struct {
+		roomID string
+		want   error
+	}{
+		{roomID: "", want: nil},
+		{roomID: "room", want: nil},
+		{roomID: "other", want: ErrRoomMismatch},
+	}
+
+	for _, test := range tests {
+		envelope := Envelope{Version: Version, Type: TypeMessage, RoomID: test.roomID}
+		if err := envelope.CheckRoom("room"); err != test.want {
+			t.Errorf("room_id %q: got %v, want %v", test.roomID, err, test.want)
+		}
+	}
+}
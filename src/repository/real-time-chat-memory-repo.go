@@ -0,0 +1,938 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errDuplicateKey - returned when inserting a document whose id is already taken
+var errDuplicateKey = errors.New("duplicate key")
+
+// MemoryRepository - In-memory implementation of Repository with the same
+// semantics as the mongodb one, used to run without a database
+type MemoryRepository struct {
+	mu        sync.RWMutex
+	chatRooms map[primitive.ObjectID]model.ChatRoom
+	users     map[primitive.ObjectID]model.User
+	//messages of every chat room in insertion order
+	messages map[primitive.ObjectID][]model.Message
+	//last message sequence number of every chat room
+	counters map[primitive.ObjectID]int64
+	//read marker of every user of every chat room
+	readMarkers map[roomUserKey]model.ReadMarker
+	//membership of every member of every chat room
+	memberships map[roomUserKey]model.Membership
+	invitations map[primitive.ObjectID]model.Invitation
+	inviteLinks map[string]model.InviteLink
+}
+
+// roomUserKey - identifies a user in a chat room
+type roomUserKey struct {
+	roomID primitive.ObjectID
+	userID primitive.ObjectID
+}
+
+// NewMemoryRepository - returns an empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		chatRooms:   make(map[primitive.ObjectID]model.ChatRoom),
+		users:       make(map[primitive.ObjectID]model.User),
+		messages:    make(map[primitive.ObjectID][]model.Message),
+		counters:    make(map[primitive.ObjectID]int64),
+		readMarkers: make(map[roomUserKey]model.ReadMarker),
+		memberships: make(map[roomUserKey]model.Membership),
+		invitations: make(map[primitive.ObjectID]model.Invitation),
+		inviteLinks: make(map[string]model.InviteLink),
+	}
+}
+
+// compareIDs - orders object ids the way mongodb sorts them
+func compareIDs(a primitive.ObjectID, b primitive.ObjectID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// CreateChatRoom - Inserts chat room
+func (memory *MemoryRepository) CreateChatRoom(chatRoom model.ChatRoom) (primitive.ObjectID, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if chatRoom.ID.IsZero() {
+		chatRoom.ID = primitive.NewObjectID()
+	}
+	if _, ok := memory.chatRooms[chatRoom.ID]; ok {
+		return primitive.NilObjectID, errDuplicateKey
+	}
+
+	memory.chatRooms[chatRoom.ID] = chatRoom
+
+	return chatRoom.ID, nil
+}
+
+// FindAllChatRooms - Find all public chat-rooms and the private chat-rooms the
+// user is a member of
+func (memory *MemoryRepository) FindAllChatRooms(userID primitive.ObjectID) ([]model.ChatRoom, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var chatRooms []model.ChatRoom
+	for _, chatRoom := range memory.chatRooms {
+		//private chat rooms are only listed to their members
+		if chatRoom.Visibility == model.ChatRoomPrivate {
+			if _, ok := memory.memberships[roomUserKey{roomID: chatRoom.ID, userID: userID}]; !ok {
+				continue
+			}
+		}
+		chatRooms = append(chatRooms, chatRoom)
+	}
+
+	//insertion order
+	sort.Slice(chatRooms, func(i, j int) bool {
+		return compareIDs(chatRooms[i].ID, chatRooms[j].ID) < 0
+	})
+
+	return chatRooms, nil
+}
+
+// FindChatRoomByID - Find chat room by id
+func (memory *MemoryRepository) FindChatRoomByID(id primitive.ObjectID) (model.ChatRoom, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	chatRoom, ok := memory.chatRooms[id]
+	if !ok {
+		return chatRoom, ErrNotFound
+	}
+
+	return chatRoom, nil
+}
+
+// UpdateChatRoom - Updates the name of the chat room
+func (memory *MemoryRepository) UpdateChatRoom(chatRoom model.ChatRoom) (model.ChatRoom, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	room, ok := memory.chatRooms[chatRoom.ID]
+	if !ok {
+		return room, ErrNotFound
+	}
+
+	room.Name = chatRoom.Name
+	memory.chatRooms[room.ID] = room
+
+	return room, nil
+}
+
+// DeleteChatRoom - Deletes chat room by id, its memberships, invitations and
+// invite links
+func (memory *MemoryRepository) DeleteChatRoom(id primitive.ObjectID) (int64, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if _, ok := memory.chatRooms[id]; !ok {
+		return 0, nil
+	}
+
+	delete(memory.chatRooms, id)
+
+	//the members of a deleted chat room are gone with it
+	for key := range memory.memberships {
+		if key.roomID == id {
+			delete(memory.memberships, key)
+		}
+	}
+
+	//as well as the invitations and invite links to it
+	for invitationID, invitation := range memory.invitations {
+		if invitation.ChatRoomID == id {
+			delete(memory.invitations, invitationID)
+		}
+	}
+	for code, link := range memory.inviteLinks {
+		if link.ChatRoomID == id {
+			delete(memory.inviteLinks, code)
+		}
+	}
+
+	return 1, nil
+}
+
+// CountChatRoomByChatName - Counts chat-room by name
+func (memory *MemoryRepository) CountChatRoomByChatName(name string) (int64, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var count int64
+	for _, chatRoom := range memory.chatRooms {
+		if chatRoom.Name == name {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CountChatRoomByID - Counts chat-room by id
+func (memory *MemoryRepository) CountChatRoomByID(id primitive.ObjectID) (int64, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	if _, ok := memory.chatRooms[id]; !ok {
+		return 0, nil
+	}
+
+	return 1, nil
+}
+
+// FindOrCreateDirectChatRoom - Finds the direct chat room of the two users, it is
+// created by the first call so that a pair of users has a single one
+func (memory *MemoryRepository) FindOrCreateDirectChatRoom(userID primitive.ObjectID, otherUserID primitive.ObjectID) (model.ChatRoom, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	key, members := directKey(userID, otherUserID)
+
+	for _, room := range memory.chatRooms {
+		if room.DirectKey == key {
+			return room, nil
+		}
+	}
+
+	room := model.ChatRoom{
+		ID:        primitive.NewObjectID(),
+		Type:      model.ChatRoomTypeDirect,
+		Members:   members,
+		DirectKey: key,
+	}
+	memory.chatRooms[room.ID] = room
+
+	//both users are members
+	for _, member := range members {
+		memory.memberships[roomUserKey{roomID: room.ID, userID: member}] = model.Membership{
+			ChatRoomID: room.ID,
+			UserID:     member,
+			Role:       model.RoleMember,
+			JoinedAt:   time.Now().UTC(),
+		}
+	}
+
+	return room, nil
+}
+
+// CreateUser - Inserts user
+func (memory *MemoryRepository) CreateUser(user model.User) (primitive.ObjectID, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if _, ok := memory.users[user.ID]; ok {
+		return primitive.NilObjectID, errDuplicateKey
+	}
+
+	memory.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// FindUserByID - Find user by id
+func (memory *MemoryRepository) FindUserByID(id primitive.ObjectID) (model.User, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	user, ok := memory.users[id]
+	if !ok {
+		return user, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// FindUsersByIDs - Finds the users with the given ids, sorted by id, the ids
+// of missing users are skipped
+func (memory *MemoryRepository) FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	users := []model.User{}
+	found := make(map[primitive.ObjectID]bool)
+	for _, id := range ids {
+		user, ok := memory.users[id]
+		if !ok || found[id] {
+			continue
+		}
+		found[id] = true
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return compareIDs(users[i].ID, users[j].ID) < 0
+	})
+
+	return users, nil
+}
+
+// UpdateUser - Updates names and password of the user
+func (memory *MemoryRepository) UpdateUser(u model.User) (model.User, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	user, ok := memory.users[u.ID]
+	if !ok {
+		return user, ErrNotFound
+	}
+
+	user.FirstName = u.FirstName
+	user.LastName = u.LastName
+	user.Password = u.Password
+	memory.users[user.ID] = user
+
+	return user, nil
+}
+
+// FindUserByUsername - Finds user by username
+func (memory *MemoryRepository) FindUserByUsername(username string) (model.User, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	for _, user := range memory.users {
+		if user.UserName == username {
+			return user, nil
+		}
+	}
+
+	return model.User{}, ErrNotFound
+}
+
+// CountUserByUsername - Counts user by username
+func (memory *MemoryRepository) CountUserByUsername(username string) (int64, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var count int64
+	for _, user := range memory.users {
+		if user.UserName == username {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CreateMessage - Stamps the message with its creation time and the next
+// sequence number of its chat room and inserts it, a message resent with the
+// same client message id returns the stored one with ErrDuplicateMessage
+func (memory *MemoryRepository) CreateMessage(message model.Message) (model.Message, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if message.ClientMessageID != "" {
+		for _, original := range memory.messages[message.ChatRoomID] {
+			if original.UserID == message.UserID && original.ClientMessageID == message.ClientMessageID {
+				return original, ErrDuplicateMessage
+			}
+		}
+	}
+
+	memory.counters[message.ChatRoomID]++
+
+	message.ID = primitive.NewObjectID()
+	message.Seq = memory.counters[message.ChatRoomID]
+	message.CreatedAt = time.Now().UTC()
+
+	memory.messages[message.ChatRoomID] = append(memory.messages[message.ChatRoomID], message)
+
+	return message, nil
+}
+
+// FindMessagesByChatRoomID - Finds a page of messages of a chat room newest first,
+// before and after are optional message id cursors bounding the page
+func (memory *MemoryRepository) FindMessagesByChatRoomID(roomID primitive.ObjectID, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	return messagePage(memory.messages[roomID], before, after, limit), nil
+}
+
+// FindReplies - Finds a page of replies to a message newest first, before and
+// after are optional message id cursors bounding the page
+func (memory *MemoryRepository) FindReplies(parentID primitive.ObjectID, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	parent, ok := memory.findMessage(parentID)
+	if !ok {
+		return []model.Message{}, nil
+	}
+
+	var replies []model.Message
+	for _, message := range memory.messages[parent.ChatRoomID] {
+		if message.ParentID != nil && *message.ParentID == parentID {
+			replies = append(replies, message)
+		}
+	}
+
+	return messagePage(replies, before, after, limit), nil
+}
+
+// messagePage - returns a page of the given messages newest first, before and
+// after are optional message id cursors bounding the page
+func messagePage(all []model.Message, before primitive.ObjectID, after primitive.ObjectID, limit int64) []model.Message {
+
+	//messages inside the cursors, oldest first
+	var matching []model.Message
+	for _, message := range all {
+		if !before.IsZero() && compareIDs(message.ID, before) >= 0 {
+			continue
+		}
+		if !after.IsZero() && compareIDs(message.ID, after) <= 0 {
+			continue
+		}
+		matching = append(matching, message)
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return compareIDs(matching[i].ID, matching[j].ID) < 0
+	})
+
+	//when only paging forward keep the oldest messages after the cursor,
+	//otherwise the newest ones
+	if limit > 0 && int64(len(matching)) > limit {
+		if !after.IsZero() && before.IsZero() {
+			matching = matching[:limit]
+		} else {
+			matching = matching[int64(len(matching))-limit:]
+		}
+	}
+
+	//newest first
+	messages := make([]model.Message, 0, len(matching))
+	for i := len(matching) - 1; i >= 0; i-- {
+		messages = append(messages, matching[i])
+	}
+
+	return messages
+}
+
+// FindMessageByID - Find message by id
+func (memory *MemoryRepository) FindMessageByID(id primitive.ObjectID) (model.Message, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	message, ok := memory.findMessage(id)
+	if !ok {
+		return model.Message{}, ErrNotFound
+	}
+
+	return message, nil
+}
+
+// FindMessagesAfterSeq - Finds the messages of a chat room with a sequence number
+// greater than afterSeq, oldest first
+func (memory *MemoryRepository) FindMessagesAfterSeq(roomID primitive.ObjectID, afterSeq int64, limit int64) ([]model.Message, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	messages := []model.Message{}
+	for _, message := range memory.messages[roomID] {
+		if message.Seq <= afterSeq {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Seq < messages[j].Seq
+	})
+
+	if limit > 0 && int64(len(messages)) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+// AddReply - Increments the reply count of a message and sets the time of its
+// last reply, returns the updated message
+func (memory *MemoryRepository) AddReply(parentID primitive.ObjectID, replyAt time.Time) (model.Message, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	parent, ok := memory.findMessage(parentID)
+	if !ok {
+		return model.Message{}, ErrNotFound
+	}
+
+	parent.ReplyCount++
+	if parent.LastReplyAt == nil || replyAt.After(*parent.LastReplyAt) {
+		parent.LastReplyAt = &replyAt
+	}
+
+	memory.replaceMessage(parent)
+
+	return parent, nil
+}
+
+// EditMessage - Replaces the body of a message that is not deleted, the previous
+// body is appended to the edit history of the message
+func (memory *MemoryRepository) EditMessage(id primitive.ObjectID, body string) (model.Message, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	message, ok := memory.findMessage(id)
+	if !ok || message.Deleted {
+		return model.Message{}, ErrNotFound
+	}
+
+	previous := model.MessageEdit{Body: message.Body, CreatedAt: message.CreatedAt}
+	if message.EditedAt != nil {
+		previous.CreatedAt = *message.EditedAt
+	}
+
+	now := time.Now().UTC()
+
+	//copy the history, the stored one may be shared with returned messages
+	edits := make([]model.MessageEdit, 0, len(message.Edits)+1)
+	message.Edits = append(append(edits, message.Edits...), previous)
+	message.Body = body
+	message.EditedAt = &now
+
+	memory.replaceMessage(message)
+
+	return message, nil
+}
+
+// DeleteMessage - Turns a message that is not deleted into a tombstone, its body,
+// edit history and reactions are removed but it keeps its place in the chat room
+func (memory *MemoryRepository) DeleteMessage(id primitive.ObjectID) (model.Message, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	message, ok := memory.findMessage(id)
+	if !ok || message.Deleted {
+		return model.Message{}, ErrNotFound
+	}
+
+	now := time.Now().UTC()
+
+	message.Body = ""
+	message.Edits = nil
+	message.Reactions = nil
+	message.Deleted = true
+	message.DeletedAt = &now
+
+	memory.replaceMessage(message)
+
+	return message, nil
+}
+
+// AddReaction - Adds the reaction to a message that is not deleted, a user can
+// react once with each emoji so adding it again changes nothing
+func (memory *MemoryRepository) AddReaction(id primitive.ObjectID, reaction model.Reaction) (model.Message, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	message, ok := memory.findMessage(id)
+	if !ok || message.Deleted {
+		return model.Message{}, ErrNotFound
+	}
+
+	for _, existing := range message.Reactions {
+		if existing == reaction {
+			return message, nil
+		}
+	}
+
+	//copy the reactions, the stored ones may be shared with returned messages
+	reactions := make([]model.Reaction, 0, len(message.Reactions)+1)
+	message.Reactions = append(append(reactions, message.Reactions...), reaction)
+
+	memory.replaceMessage(message)
+
+	return message, nil
+}
+
+// RemoveReaction - Removes the reaction from a message that is not deleted,
+// removing a missing reaction changes nothing
+func (memory *MemoryRepository) RemoveReaction(id primitive.ObjectID, reaction model.Reaction) (model.Message, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	message, ok := memory.findMessage(id)
+	if !ok || message.Deleted {
+		return model.Message{}, ErrNotFound
+	}
+
+	reactions := make([]model.Reaction, 0, len(message.Reactions))
+	for _, existing := range message.Reactions {
+		if existing != reaction {
+			reactions = append(reactions, existing)
+		}
+	}
+	message.Reactions = reactions
+
+	memory.replaceMessage(message)
+
+	return message, nil
+}
+
+// findMessage - returns the message with the given id, memory.mu must be held
+func (memory *MemoryRepository) findMessage(id primitive.ObjectID) (model.Message, bool) {
+	for _, messages := range memory.messages {
+		for _, message := range messages {
+			if message.ID == id {
+				return message, true
+			}
+		}
+	}
+	return model.Message{}, false
+}
+
+// replaceMessage - stores the message in place of the one with the same id,
+// memory.mu must be held
+func (memory *MemoryRepository) replaceMessage(message model.Message) {
+	messages := memory.messages[message.ChatRoomID]
+	for i := range messages {
+		if messages[i].ID == message.ID {
+			messages[i] = message
+			return
+		}
+	}
+}
+
+// AddMember - Inserts the membership stamped with the join time, a user already
+// member of the chat room returns the current membership with ErrAlreadyMember
+func (memory *MemoryRepository) AddMember(membership model.Membership) (model.Membership, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	key := roomUserKey{roomID: membership.ChatRoomID, userID: membership.UserID}
+
+	if current, ok := memory.memberships[key]; ok {
+		return current, ErrAlreadyMember
+	}
+
+	membership.JoinedAt = time.Now().UTC()
+	memory.memberships[key] = membership
+
+	return membership, nil
+}
+
+// FindMember - Find the membership of the user in the chat room
+func (memory *MemoryRepository) FindMember(roomID primitive.ObjectID, userID primitive.ObjectID) (model.Membership, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	membership, ok := memory.memberships[roomUserKey{roomID: roomID, userID: userID}]
+	if !ok {
+		return model.Membership{}, ErrNotFound
+	}
+
+	return membership, nil
+}
+
+// FindMembers - Finds the memberships of a chat room in join order
+func (memory *MemoryRepository) FindMembers(roomID primitive.ObjectID) ([]model.Membership, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	memberships := []model.Membership{}
+	for key, membership := range memory.memberships {
+		if key.roomID == roomID {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].JoinedAt.Before(memberships[j].JoinedAt)
+	})
+
+	return memberships, nil
+}
+
+// UpdateMemberRole - Changes the role of a member of the chat room
+func (memory *MemoryRepository) UpdateMemberRole(roomID primitive.ObjectID, userID primitive.ObjectID, role string) (model.Membership, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	key := roomUserKey{roomID: roomID, userID: userID}
+
+	membership, ok := memory.memberships[key]
+	if !ok {
+		return model.Membership{}, ErrNotFound
+	}
+
+	membership.Role = role
+	memory.memberships[key] = membership
+
+	return membership, nil
+}
+
+// RemoveMember - Deletes the membership of the user in the chat room
+func (memory *MemoryRepository) RemoveMember(roomID primitive.ObjectID, userID primitive.ObjectID) (int64, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	key := roomUserKey{roomID: roomID, userID: userID}
+
+	if _, ok := memory.memberships[key]; !ok {
+		return 0, nil
+	}
+
+	delete(memory.memberships, key)
+
+	return 1, nil
+}
+
+// CreateInvitation - Inserts the pending invitation stamped with the creation
+// time, a user already invited to the chat room gets the pending invitation with
+// ErrAlreadyInvited
+func (memory *MemoryRepository) CreateInvitation(invitation model.Invitation) (model.Invitation, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	for _, pending := range memory.invitations {
+		if pending.ChatRoomID == invitation.ChatRoomID && pending.UserID == invitation.UserID && pending.Status == model.InvitationPending {
+			return pending, ErrAlreadyInvited
+		}
+	}
+
+	invitation.ID = primitive.NewObjectID()
+	invitation.Status = model.InvitationPending
+	invitation.CreatedAt = time.Now().UTC()
+	memory.invitations[invitation.ID] = invitation
+
+	return invitation, nil
+}
+
+// FindInvitationByID - Find invitation by id
+func (memory *MemoryRepository) FindInvitationByID(id primitive.ObjectID) (model.Invitation, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	invitation, ok := memory.invitations[id]
+	if !ok {
+		return model.Invitation{}, ErrNotFound
+	}
+
+	return invitation, nil
+}
+
+// FindPendingInvitations - Finds the pending invitations of the user oldest first
+func (memory *MemoryRepository) FindPendingInvitations(userID primitive.ObjectID) ([]model.Invitation, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	invitations := []model.Invitation{}
+	for _, invitation := range memory.invitations {
+		if invitation.UserID == userID && invitation.Status == model.InvitationPending {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return compareIDs(invitations[i].ID, invitations[j].ID) < 0
+	})
+
+	return invitations, nil
+}
+
+// RespondInvitation - Accepts or declines a pending invitation, an invitation
+// that is not pending anymore returns ErrNotFound
+func (memory *MemoryRepository) RespondInvitation(id primitive.ObjectID, status string) (model.Invitation, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	invitation, ok := memory.invitations[id]
+	if !ok || invitation.Status != model.InvitationPending {
+		return model.Invitation{}, ErrNotFound
+	}
+
+	respondedAt := time.Now().UTC()
+	invitation.Status = status
+	invitation.RespondedAt = &respondedAt
+	memory.invitations[id] = invitation
+
+	return invitation, nil
+}
+
+// CreateInviteLink - Inserts the invite link stamped with the creation time
+func (memory *MemoryRepository) CreateInviteLink(link model.InviteLink) (model.InviteLink, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if _, ok := memory.inviteLinks[link.Code]; ok {
+		return link, errors.New("duplicate invite link code")
+	}
+
+	link.ID = primitive.NewObjectID()
+	link.CreatedAt = time.Now().UTC()
+	link.Uses = 0
+	memory.inviteLinks[link.Code] = link
+
+	return link, nil
+}
+
+// FindInviteLinkByCode - Find invite link by code, active or not
+func (memory *MemoryRepository) FindInviteLinkByCode(code string) (model.InviteLink, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	link, ok := memory.inviteLinks[code]
+	if !ok {
+		return model.InviteLink{}, ErrNotFound
+	}
+
+	return link, nil
+}
+
+// FindActiveInviteLinks - Finds the invite links of a chat room that can still
+// be redeemed at the given time, oldest first
+func (memory *MemoryRepository) FindActiveInviteLinks(roomID primitive.ObjectID, now time.Time) ([]model.InviteLink, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	links := []model.InviteLink{}
+	for _, link := range memory.inviteLinks {
+		if link.ChatRoomID == roomID && link.Active(now) {
+			links = append(links, link)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return compareIDs(links[i].ID, links[j].ID) < 0
+	})
+
+	return links, nil
+}
+
+// UseInviteLink - Counts a use of the invite link, an invite link that can not
+// be redeemed at the given time anymore returns ErrNotFound
+func (memory *MemoryRepository) UseInviteLink(code string, now time.Time) (model.InviteLink, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	link, ok := memory.inviteLinks[code]
+	if !ok || !link.Active(now) {
+		return model.InviteLink{}, ErrNotFound
+	}
+
+	link.Uses++
+	memory.inviteLinks[code] = link
+
+	return link, nil
+}
+
+// RevokeInviteLink - Revokes an invite link of the chat room, an invite link
+// already revoked returns ErrNotFound
+func (memory *MemoryRepository) RevokeInviteLink(roomID primitive.ObjectID, code string) (model.InviteLink, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	link, ok := memory.inviteLinks[code]
+	if !ok || link.ChatRoomID != roomID || link.RevokedAt != nil {
+		return model.InviteLink{}, ErrNotFound
+	}
+
+	revokedAt := time.Now().UTC()
+	link.RevokedAt = &revokedAt
+	memory.inviteLinks[code] = link
+
+	return link, nil
+}
+
+// UpdateReadMarker - Moves the read marker of the user in the chat room forward
+// to the given message, creating it on the first read. A marker already at or
+// after the message is left as is and returned with ErrReadMarkerBehind.
+func (memory *MemoryRepository) UpdateReadMarker(marker model.ReadMarker) (model.ReadMarker, error) {
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	key := roomUserKey{roomID: marker.ChatRoomID, userID: marker.UserID}
+
+	current, ok := memory.readMarkers[key]
+	if ok && current.Seq >= marker.Seq {
+		return current, ErrReadMarkerBehind
+	}
+
+	marker.UpdatedAt = time.Now().UTC()
+	memory.readMarkers[key] = marker
+
+	return marker, nil
+}
+
+// FindReadMarker - Find the read marker of the user in the chat room
+func (memory *MemoryRepository) FindReadMarker(roomID primitive.ObjectID, userID primitive.ObjectID) (model.ReadMarker, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	marker, ok := memory.readMarkers[roomUserKey{roomID: roomID, userID: userID}]
+	if !ok {
+		return model.ReadMarker{}, ErrNotFound
+	}
+
+	return marker, nil
+}
+
+// CountUnreadMessages - Counts the messages of a chat room with a sequence number
+// greater than afterSeq sent by other users than the given one, deleted
+// messages are not counted
+func (memory *MemoryRepository) CountUnreadMessages(roomID primitive.ObjectID, userID primitive.ObjectID, afterSeq int64) (int64, error) {
+
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var count int64
+	for _, message := range memory.messages[roomID] {
+		if message.Seq > afterSeq && message.UserID != userID && !message.Deleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -3,41 +3,95 @@ package repository
 import (
 	"context"
 	"github.com/Tainzen/realtime-chat/src/model"
-	"github.com/Tainzen/realtime-chat/utils/database"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 )
 
-// chat room collection
-var chatRoomCollection = database.Db().Database("realtime_chat").Collection("chat_rooms")
+// databaseName - mongodb database of the service
+const databaseName = "realtime_chat"
 
-// user collection
-var userCollection = database.Db().Database("realtime_chat").Collection("users")
+// storedMessageWait - longest wait for the sequence number of a message stored
+// concurrently with the same client message id
+const storedMessageWait = time.Second
 
-// message collection
-var messageCollection = database.Db().Database("realtime_chat").Collection("messages")
+// RealTimeChatRepository - Mongodb implementation of Repository
+type RealTimeChatRepository struct {
+	// chat room collection
+	chatRoomCollection *mongo.Collection
+	// user collection
+	userCollection *mongo.Collection
+	// message collection
+	messageCollection *mongo.Collection
+	// counter collection, keeps the last message sequence number of every chat room
+	counterCollection *mongo.Collection
+	// read marker collection, keeps the last message read by every user of every chat room
+	readMarkerCollection *mongo.Collection
+	// membership collection, keeps the role of every member of every chat room
+	membershipCollection *mongo.Collection
+	// invitation collection, keeps the invitations of users to chat rooms
+	invitationCollection *mongo.Collection
+	// invite link collection, keeps the shareable codes joining chat rooms
+	inviteLinkCollection *mongo.Collection
+}
+
+// NewRealTimeChatRepository - returns a repository storing into the mongodb client
+func NewRealTimeChatRepository(client *mongo.Client) *RealTimeChatRepository {
+	return newRealTimeChatRepository(client.Database(databaseName))
+}
+
+// newRealTimeChatRepository - returns a repository storing into the database
+func newRealTimeChatRepository(db *mongo.Database) *RealTimeChatRepository {
+	return &RealTimeChatRepository{
+		chatRoomCollection:   db.Collection("chat_rooms"),
+		userCollection:       db.Collection("users"),
+		messageCollection:    db.Collection("messages"),
+		counterCollection:    db.Collection("counters"),
+		readMarkerCollection: db.Collection("read_markers"),
+		membershipCollection: db.Collection("memberships"),
+		invitationCollection: db.Collection("invitations"),
+		inviteLinkCollection: db.Collection("invite_links"),
+	}
+}
 
-// realTimeChatRepository - Structure
-type RealTimeChatRepository struct{}
+// notFound - translates the mongodb missing document error into ErrNotFound
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
 
 // CreateChatRoom - Inserts chat room into db
-func (realTimeChat *RealTimeChatRepository) CreateChatRoom(chatRoom model.ChatRoom) (interface{}, error) {
+func (realTimeChat *RealTimeChatRepository) CreateChatRoom(chatRoom model.ChatRoom) (primitive.ObjectID, error) {
 	//insert into mongodb
-	result, err := chatRoomCollection.InsertOne(context.TODO(), chatRoom)
+	result, err := realTimeChat.chatRoomCollection.InsertOne(context.TODO(), chatRoom)
 	if err != nil {
-		return nil, err
+		return primitive.NilObjectID, err
 	}
 
-	return result.InsertedID, nil
+	return result.InsertedID.(primitive.ObjectID), nil
 }
 
-// FindAllChatRooms - Find all chat-rooms
-func (realTimeChat *RealTimeChatRepository) FindAllChatRooms() ([]model.ChatRoom, error) {
+// FindAllChatRooms - Find all public chat-rooms and the private chat-rooms the
+// user is a member of
+func (realTimeChat *RealTimeChatRepository) FindAllChatRooms(userID primitive.ObjectID) ([]model.ChatRoom, error) {
+
+	//chat rooms the user is a member of
+	roomIDs, err := realTimeChat.memberRoomIDs(userID)
+	if err != nil {
+		return nil, err
+	}
 
 	var chatRooms []model.ChatRoom
-	//find all chat-rooms
-	cur, err := chatRoomCollection.Find(context.TODO(), bson.D{{}})
+	//find public chat-rooms and the private ones of the user
+	filter := bson.M{"$or": bson.A{
+		bson.M{"visibility": bson.M{"$ne": model.ChatRoomPrivate}},
+		bson.M{"_id": bson.M{"$in": roomIDs}},
+	}}
+	cur, err := realTimeChat.chatRoomCollection.Find(context.TODO(), filter)
 	if err != nil {
 		return nil, err
 	}
@@ -57,14 +111,41 @@ func (realTimeChat *RealTimeChatRepository) FindAllChatRooms() ([]model.ChatRoom
 	return chatRooms, nil
 }
 
+// memberRoomIDs - ids of the chat rooms the user is a member of
+func (realTimeChat *RealTimeChatRepository) memberRoomIDs(userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+
+	roomIDs := []primitive.ObjectID{}
+
+	opts := options.Find().SetProjection(bson.M{"chatroom_id": 1})
+
+	cur, err := realTimeChat.membershipCollection.Find(context.TODO(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var membership model.Membership
+		err := cur.Decode(&membership)
+		if err != nil {
+			return nil, err
+		}
+
+		roomIDs = append(roomIDs, membership.ChatRoomID)
+	}
+
+	return roomIDs, cur.Err()
+}
+
 // FindChatRoomByID - Find chat room by id
 func (realTimeChat *RealTimeChatRepository) FindChatRoomByID(id primitive.ObjectID) (model.ChatRoom, error) {
 
 	var chatRoom model.ChatRoom
 	//find chat-room with id
-	err := chatRoomCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&chatRoom)
+	err := realTimeChat.chatRoomCollection.FindOne(context.TODO(), bson.D{{Key: "_id", Value: id}}).Decode(&chatRoom)
 	if err != nil {
-		return chatRoom, err
+		return chatRoom, notFound(err)
 	}
 
 	return chatRoom, nil
@@ -75,7 +156,7 @@ func (realTimeChat *RealTimeChatRepository) UpdateChatRoom(chatRoom model.ChatRo
 
 	var room model.ChatRoom
 	//filter
-	filter := bson.D{{"_id", chatRoom.ID}}
+	filter := bson.D{{Key: "_id", Value: chatRoom.ID}}
 
 	//to return updated document
 	after := options.After
@@ -84,37 +165,55 @@ func (realTimeChat *RealTimeChatRepository) UpdateChatRoom(chatRoom model.ChatRo
 		ReturnDocument: &after,
 	}
 
-	update := bson.D{{"$set", bson.D{{"name", chatRoom.Name}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: chatRoom.Name}}}}
 
-	err := chatRoomCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&room)
+	err := realTimeChat.chatRoomCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&room)
 	if err != nil {
-		return room, err
+		return room, notFound(err)
 	}
 
 	return room, nil
 }
 
-// DeleteChatRoom - Deletes chat room by id from db
-func (realTimeChat *RealTimeChatRepository) DeleteChatRoom(id primitive.ObjectID) (interface{}, error) {
+// DeleteChatRoom - Deletes chat room by id, its memberships, invitations and
+// invite links from db
+func (realTimeChat *RealTimeChatRepository) DeleteChatRoom(id primitive.ObjectID) (int64, error) {
 
 	//options
 	opts := options.Delete().SetCollation(&options.Collation{})
 	//filter by id
-	filter := bson.D{{"_id", id}}
-	res, err := chatRoomCollection.DeleteOne(context.TODO(), filter, opts)
+	filter := bson.D{{Key: "_id", Value: id}}
+	res, err := realTimeChat.chatRoomCollection.DeleteOne(context.TODO(), filter, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	//the members of a deleted chat room are gone with it
+	_, err = realTimeChat.membershipCollection.DeleteMany(context.TODO(), bson.M{"chatroom_id": id})
+	if err != nil {
+		return res.DeletedCount, err
+	}
+
+	//as well as the invitations and invite links to it
+	_, err = realTimeChat.invitationCollection.DeleteMany(context.TODO(), bson.M{"chatroom_id": id})
 	if err != nil {
-		return res, err
+		return res.DeletedCount, err
 	}
 
-	return res, nil
+	_, err = realTimeChat.inviteLinkCollection.DeleteMany(context.TODO(), bson.M{"chatroom_id": id})
+	if err != nil {
+		return res.DeletedCount, err
+	}
+
+	return res.DeletedCount, nil
 }
 
 // CountChatByChatName - Counts chat-room by username into db
 func (realTimeChat *RealTimeChatRepository) CountChatRoomByChatName(name string) (int64, error) {
 
 	//filter by name
-	filter := bson.D{{"name", name}}
-	count, err := userCollection.CountDocuments(context.TODO(), filter)
+	filter := bson.D{{Key: "name", Value: name}}
+	count, err := realTimeChat.chatRoomCollection.CountDocuments(context.TODO(), filter)
 	if err != nil {
 		return 0, err
 	}
@@ -126,8 +225,8 @@ func (realTimeChat *RealTimeChatRepository) CountChatRoomByChatName(name string)
 func (realTimeChat *RealTimeChatRepository) CountChatRoomByID(id primitive.ObjectID) (int64, error) {
 
 	//filter by id
-	filter := bson.D{{"_id", id}}
-	count, err := userCollection.CountDocuments(context.TODO(), filter)
+	filter := bson.D{{Key: "_id", Value: id}}
+	count, err := realTimeChat.chatRoomCollection.CountDocuments(context.TODO(), filter)
 	if err != nil {
 		return 0, err
 	}
@@ -135,15 +234,60 @@ func (realTimeChat *RealTimeChatRepository) CountChatRoomByID(id primitive.Objec
 	return count, nil
 }
 
+// FindOrCreateDirectChatRoom - Finds the direct chat room of the two users, it is
+// created by the first call so that a pair of users has a single one
+func (realTimeChat *RealTimeChatRepository) FindOrCreateDirectChatRoom(userID primitive.ObjectID, otherUserID primitive.ObjectID) (model.ChatRoom, error) {
+
+	var room model.ChatRoom
+
+	key, members := directKey(userID, otherUserID)
+
+	//filter by the unique direct key index
+	filter := bson.M{"direct_key": key}
+
+	//to return the document, creating it on the first call
+	after := options.After
+	upsert := true
+
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	update := bson.M{"$setOnInsert": bson.M{
+		"type":    model.ChatRoomTypeDirect,
+		"members": members,
+	}}
+
+	err := realTimeChat.chatRoomCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&room)
+	if mongo.IsDuplicateKeyError(err) {
+		//the room was created concurrently
+		err = realTimeChat.chatRoomCollection.FindOne(context.TODO(), filter).Decode(&room)
+	}
+	if err != nil {
+		return room, err
+	}
+
+	//both users are members, done on every call in case a previous one failed
+	for _, member := range members {
+		_, err = realTimeChat.AddMember(model.Membership{ChatRoomID: room.ID, UserID: member, Role: model.RoleMember})
+		if err != nil && err != ErrAlreadyMember {
+			return room, err
+		}
+	}
+
+	return room, nil
+}
+
 // CreateUser - Inserts user into db
-func (realTimeChat *RealTimeChatRepository) CreateUser(user model.User) (interface{}, error) {
+func (realTimeChat *RealTimeChatRepository) CreateUser(user model.User) (primitive.ObjectID, error) {
 	//insert into mongodb
-	result, err := userCollection.InsertOne(context.TODO(), user)
+	result, err := realTimeChat.userCollection.InsertOne(context.TODO(), user)
 	if err != nil {
-		return nil, err
+		return primitive.NilObjectID, err
 	}
 
-	return result.InsertedID, nil
+	return result.InsertedID.(primitive.ObjectID), nil
 }
 
 // FindUserByID - Find user by id
@@ -151,14 +295,52 @@ func (realTimeChat *RealTimeChatRepository) FindUserByID(id primitive.ObjectID)
 
 	var user model.User
 	//find user with id
-	err := userCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&user)
+	err := realTimeChat.userCollection.FindOne(context.TODO(), bson.D{{Key: "_id", Value: id}}).Decode(&user)
 	if err != nil {
-		return user, err
+		return user, notFound(err)
 	}
 
 	return user, nil
 }
 
+// FindUsersByIDs - Finds the users with the given ids in a single query, sorted
+// by id, the ids of missing users are skipped
+func (realTimeChat *RealTimeChatRepository) FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error) {
+
+	users := []model.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	//filter by ids
+	filter := bson.M{"_id": bson.M{"$in": ids}}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	cur, err := realTimeChat.userCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var user model.User
+		err := cur.Decode(&user)
+		if err != nil {
+			return nil, err
+		}
+
+		//appending users
+		users = append(users, user)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 // UpdateUser - Updates user into db
 func (realTimeChat *RealTimeChatRepository) UpdateUser(u model.User) (model.User, error) {
 
@@ -175,9 +357,9 @@ func (realTimeChat *RealTimeChatRepository) UpdateUser(u model.User) (model.User
 
 	update := bson.M{"$set": bson.M{"firstname": u.FirstName, "lastname": u.LastName, "password": u.Password}}
 
-	err := userCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&user)
+	err := realTimeChat.userCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&user)
 	if err != nil {
-		return user, err
+		return user, notFound(err)
 	}
 	return user, nil
 }
@@ -187,10 +369,10 @@ func (realTimeChat *RealTimeChatRepository) FindUserByUsername(username string)
 	var result model.User
 
 	//filter by username
-	filter := bson.D{{"username", username}}
-	err := userCollection.FindOne(context.TODO(), filter).Decode(&result)
+	filter := bson.D{{Key: "username", Value: username}}
+	err := realTimeChat.userCollection.FindOne(context.TODO(), filter).Decode(&result)
 	if err != nil {
-		return result, err
+		return result, notFound(err)
 	}
 
 	return result, nil
@@ -200,8 +382,8 @@ func (realTimeChat *RealTimeChatRepository) FindUserByUsername(username string)
 func (realTimeChat *RealTimeChatRepository) CountUserByUsername(username string) (int64, error) {
 
 	//filter by username
-	filter := bson.D{{"username", username}}
-	count, err := userCollection.CountDocuments(context.TODO(), filter)
+	filter := bson.D{{Key: "username", Value: username}}
+	count, err := realTimeChat.userCollection.CountDocuments(context.TODO(), filter)
 	if err != nil {
 		return 0, err
 	}
@@ -209,13 +391,792 @@ func (realTimeChat *RealTimeChatRepository) CountUserByUsername(username string)
 	return count, nil
 }
 
-// CreateMessage - Inserts message into db
-func (realTimeChat *RealTimeChatRepository) CreateMessage(message model.Message) (interface{}, error) {
+// CreateMessage - Stamps the message with its creation time and the next
+// sequence number of its chat room and inserts it into db, a message resent
+// with the same client message id returns the stored one with ErrDuplicateMessage
+func (realTimeChat *RealTimeChatRepository) CreateMessage(message model.Message) (model.Message, error) {
+
+	message.CreatedAt = time.Now().UTC()
+
+	//nothing to deduplicate without client message id
+	if message.ClientMessageID == "" {
+		seq, err := realTimeChat.nextMessageSeq(message.ChatRoomID)
+		if err != nil {
+			return message, err
+		}
+		message.Seq = seq
+
+		result, err := realTimeChat.messageCollection.InsertOne(context.TODO(), message)
+		if err != nil {
+			return message, err
+		}
+		message.ID = result.InsertedID.(primitive.ObjectID)
+
+		return message, nil
+	}
+
+	//the unique client message id index decides which copy of a resent message
+	//is stored, even across servers, and only that copy gets a sequence number
+	//so that the copies do not leave gaps in the chat room
+	result, err := realTimeChat.messageCollection.InsertOne(context.TODO(), message)
+	if mongo.IsDuplicateKeyError(err) {
+		original, err := realTimeChat.findStoredMessage(message)
+		if err != nil {
+			return message, err
+		}
+		return original, ErrDuplicateMessage
+	}
+	if err != nil {
+		return message, err
+	}
+	message.ID = result.InsertedID.(primitive.ObjectID)
+
+	seq, err := realTimeChat.nextMessageSeq(message.ChatRoomID)
+	if err == nil {
+		_, err = realTimeChat.messageCollection.UpdateOne(context.TODO(), bson.M{"_id": message.ID}, bson.M{"$set": bson.M{"seq": seq}})
+	}
+	if err != nil {
+		//let the client resend it
+		realTimeChat.messageCollection.DeleteOne(context.TODO(), bson.M{"_id": message.ID})
+		return message, err
+	}
+	message.Seq = seq
+
+	return message, nil
+}
+
+// findStoredMessage - Finds the message stored with the same client message id,
+// waiting for its sequence number when it was inserted concurrently and is
+// still getting it
+func (realTimeChat *RealTimeChatRepository) findStoredMessage(message model.Message) (model.Message, error) {
+
+	deadline := time.Now().Add(storedMessageWait)
+	for {
+		original, err := realTimeChat.findMessageByClientMessageID(message)
+		if err != nil || original.Seq != 0 || time.Now().After(deadline) {
+			return original, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// findMessageByClientMessageID - Finds the message stored by the same user in the
+// same chat room with the same client message id
+func (realTimeChat *RealTimeChatRepository) findMessageByClientMessageID(message model.Message) (model.Message, error) {
+
+	var original model.Message
+
+	//filter by the unique client message id index
+	filter := bson.M{
+		"chatroom_id":       message.ChatRoomID,
+		"user_id":           message.UserID,
+		"client_message_id": message.ClientMessageID,
+	}
+
+	err := realTimeChat.messageCollection.FindOne(context.TODO(), filter).Decode(&original)
+	if err != nil {
+		return original, notFound(err)
+	}
+
+	return original, nil
+}
+
+// nextMessageSeq - Atomically increments and returns the message sequence number of a chat room
+func (realTimeChat *RealTimeChatRepository) nextMessageSeq(roomID primitive.ObjectID) (int64, error) {
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+
+	//filter by chat room
+	filter := bson.M{"_id": roomID}
+
+	//to return updated document, creating it on the first message
+	after := options.After
+	upsert := true
+
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	update := bson.M{"$inc": bson.M{"seq": 1}}
+
+	err := realTimeChat.counterCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+
+	return counter.Seq, nil
+}
+
+// FindMessagesByChatRoomID - Finds a page of messages of a chat room newest first,
+// before and after are optional message id cursors bounding the page
+func (realTimeChat *RealTimeChatRepository) FindMessagesByChatRoomID(roomID primitive.ObjectID, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error) {
+	return realTimeChat.findMessagePage(bson.M{"chatroom_id": roomID}, before, after, limit)
+}
+
+// FindReplies - Finds a page of replies to a message newest first, before and
+// after are optional message id cursors bounding the page
+func (realTimeChat *RealTimeChatRepository) FindReplies(parentID primitive.ObjectID, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error) {
+	return realTimeChat.findMessagePage(bson.M{"parent_id": parentID}, before, after, limit)
+}
+
+// findMessagePage - Finds a page of the messages matching the filter newest first,
+// before and after are optional message id cursors bounding the page
+func (realTimeChat *RealTimeChatRepository) findMessagePage(filter bson.M, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error) {
+
+	messages := []model.Message{}
+
+	//filter by cursors
+	idFilter := bson.M{}
+	if !before.IsZero() {
+		idFilter["$lt"] = before
+	}
+	if !after.IsZero() {
+		idFilter["$gt"] = after
+	}
+
+	if len(idFilter) != 0 {
+		filter["_id"] = idFilter
+	}
+
+	//when only paging forward read the oldest messages after the cursor first
+	//so that no message is skipped, the page is reversed below
+	ascending := !after.IsZero() && before.IsZero()
+
+	sort := -1
+	if ascending {
+		sort = 1
+	}
+
+	opts := options.Find().SetSort(bson.M{"_id": sort}).SetLimit(limit)
+
+	cur, err := realTimeChat.messageCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var message model.Message
+		err := cur.Decode(&message)
+		if err != nil {
+			return nil, err
+		}
+
+		//appending messages
+		messages = append(messages, message)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	//newest first
+	if ascending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	return messages, nil
+}
+
+// FindMessageByID - Find message by id
+func (realTimeChat *RealTimeChatRepository) FindMessageByID(id primitive.ObjectID) (model.Message, error) {
+
+	var message model.Message
+	//find message with id
+	err := realTimeChat.messageCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&message)
+	if err != nil {
+		return message, notFound(err)
+	}
+
+	return message, nil
+}
+
+// FindMessagesAfterSeq - Finds the messages of a chat room with a sequence number
+// greater than afterSeq, oldest first
+func (realTimeChat *RealTimeChatRepository) FindMessagesAfterSeq(roomID primitive.ObjectID, afterSeq int64, limit int64) ([]model.Message, error) {
+
+	messages := []model.Message{}
+
+	//filter by chat room and sequence number
+	filter := bson.M{"chatroom_id": roomID, "seq": bson.M{"$gt": afterSeq}}
+	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
+
+	cur, err := realTimeChat.messageCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var message model.Message
+		err := cur.Decode(&message)
+		if err != nil {
+			return nil, err
+		}
+
+		//appending messages
+		messages = append(messages, message)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// AddReply - Increments the reply count of a message and sets the time of its
+// last reply, returns the updated message
+func (realTimeChat *RealTimeChatRepository) AddReply(parentID primitive.ObjectID, replyAt time.Time) (model.Message, error) {
+
+	var parent model.Message
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"reply_count": 1},
+		"$max": bson.M{"last_reply_at": replyAt},
+	}
+
+	err := realTimeChat.messageCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": parentID}, update, &returnOpt).Decode(&parent)
+	if err != nil {
+		return parent, notFound(err)
+	}
+
+	return parent, nil
+}
+
+// EditMessage - Replaces the body of a message that is not deleted, the previous
+// body is appended to the edit history of the message in the same update
+func (realTimeChat *RealTimeChatRepository) EditMessage(id primitive.ObjectID, body string) (model.Message, error) {
+
+	var message model.Message
+
+	//filter by id, deleted messages can not be edited
+	filter := bson.M{"_id": id, "deleted": bson.M{"$ne": true}}
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	//the expressions of the stage read the document before the update
+	previous := bson.M{
+		"body":       "$body",
+		"created_at": bson.M{"$ifNull": bson.A{"$edited_at", "$created_at"}},
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "edits", Value: bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$edits", bson.A{}}},
+				bson.A{previous},
+			}}},
+			{Key: "body", Value: bson.M{"$literal": body}},
+			{Key: "edited_at", Value: time.Now().UTC()},
+		}}},
+	}
+
+	err := realTimeChat.messageCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&message)
+	if err != nil {
+		return message, notFound(err)
+	}
+
+	return message, nil
+}
+
+// DeleteMessage - Turns a message that is not deleted into a tombstone, its body,
+// edit history and reactions are removed but it keeps its place in the chat room
+func (realTimeChat *RealTimeChatRepository) DeleteMessage(id primitive.ObjectID) (model.Message, error) {
+
+	var message model.Message
+
+	//filter by id, deleted messages can not be deleted again
+	filter := bson.M{"_id": id, "deleted": bson.M{"$ne": true}}
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"deleted": true, "deleted_at": time.Now().UTC()},
+		"$unset": bson.M{"body": "", "edits": "", "reactions": ""},
+	}
+
+	err := realTimeChat.messageCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&message)
+	if err != nil {
+		return message, notFound(err)
+	}
+
+	return message, nil
+}
+
+// AddReaction - Adds the reaction to a message that is not deleted, a user can
+// react once with each emoji so adding it again changes nothing
+func (realTimeChat *RealTimeChatRepository) AddReaction(id primitive.ObjectID, reaction model.Reaction) (model.Message, error) {
+	return realTimeChat.updateReactions(id, bson.M{"$addToSet": bson.M{"reactions": reaction}})
+}
+
+// RemoveReaction - Removes the reaction from a message that is not deleted,
+// removing a missing reaction changes nothing
+func (realTimeChat *RealTimeChatRepository) RemoveReaction(id primitive.ObjectID, reaction model.Reaction) (model.Message, error) {
+	return realTimeChat.updateReactions(id, bson.M{"$pull": bson.M{"reactions": bson.M{"emoji": reaction.Emoji, "user_id": reaction.UserID}}})
+}
+
+// updateReactions - Applies the update to the reactions of a message that is not
+// deleted and returns the updated message
+func (realTimeChat *RealTimeChatRepository) updateReactions(id primitive.ObjectID, update bson.M) (model.Message, error) {
+
+	var message model.Message
+
+	//filter by id, deleted messages can not be reacted to
+	filter := bson.M{"_id": id, "deleted": bson.M{"$ne": true}}
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	err := realTimeChat.messageCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&message)
+	if err != nil {
+		return message, notFound(err)
+	}
+
+	return message, nil
+}
+
+// AddMember - Inserts the membership stamped with the join time, a user already
+// member of the chat room returns the current membership with ErrAlreadyMember
+func (realTimeChat *RealTimeChatRepository) AddMember(membership model.Membership) (model.Membership, error) {
+
+	membership.JoinedAt = time.Now().UTC()
+
+	//insert into mongodb, the unique index rejects a second membership
+	_, err := realTimeChat.membershipCollection.InsertOne(context.TODO(), membership)
+	if mongo.IsDuplicateKeyError(err) {
+		current, err := realTimeChat.FindMember(membership.ChatRoomID, membership.UserID)
+		if err != nil {
+			return membership, err
+		}
+		return current, ErrAlreadyMember
+	}
+	if err != nil {
+		return membership, err
+	}
+
+	return membership, nil
+}
+
+// FindMember - Find the membership of the user in the chat room
+func (realTimeChat *RealTimeChatRepository) FindMember(roomID primitive.ObjectID, userID primitive.ObjectID) (model.Membership, error) {
+
+	var membership model.Membership
+
+	//filter by the unique user and chat room index
+	filter := bson.M{"chatroom_id": roomID, "user_id": userID}
+
+	err := realTimeChat.membershipCollection.FindOne(context.TODO(), filter).Decode(&membership)
+	if err != nil {
+		return membership, notFound(err)
+	}
+
+	return membership, nil
+}
+
+// FindMembers - Finds the memberships of a chat room in join order
+func (realTimeChat *RealTimeChatRepository) FindMembers(roomID primitive.ObjectID) ([]model.Membership, error) {
+
+	memberships := []model.Membership{}
+
+	opts := options.Find().SetSort(bson.M{"joined_at": 1})
+
+	cur, err := realTimeChat.membershipCollection.Find(context.TODO(), bson.M{"chatroom_id": roomID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var membership model.Membership
+		err := cur.Decode(&membership)
+		if err != nil {
+			return nil, err
+		}
+
+		//appending memberships
+		memberships = append(memberships, membership)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// UpdateMemberRole - Changes the role of a member of the chat room
+func (realTimeChat *RealTimeChatRepository) UpdateMemberRole(roomID primitive.ObjectID, userID primitive.ObjectID, role string) (model.Membership, error) {
+
+	var membership model.Membership
+
+	//filter by the unique user and chat room index
+	filter := bson.M{"chatroom_id": roomID, "user_id": userID}
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	update := bson.M{"$set": bson.M{"role": role}}
+
+	err := realTimeChat.membershipCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&membership)
+	if err != nil {
+		return membership, notFound(err)
+	}
+
+	return membership, nil
+}
+
+// RemoveMember - Deletes the membership of the user in the chat room
+func (realTimeChat *RealTimeChatRepository) RemoveMember(roomID primitive.ObjectID, userID primitive.ObjectID) (int64, error) {
+
+	//filter by the unique user and chat room index
+	filter := bson.M{"chatroom_id": roomID, "user_id": userID}
+
+	res, err := realTimeChat.membershipCollection.DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+// CreateInvitation - Inserts the pending invitation stamped with the creation
+// time, a user already invited to the chat room gets the pending invitation with
+// ErrAlreadyInvited
+func (realTimeChat *RealTimeChatRepository) CreateInvitation(invitation model.Invitation) (model.Invitation, error) {
+
+	invitation.ID = primitive.NewObjectID()
+	invitation.Status = model.InvitationPending
+	invitation.CreatedAt = time.Now().UTC()
+
+	//insert into mongodb, the unique index rejects a second pending invitation
+	_, err := realTimeChat.invitationCollection.InsertOne(context.TODO(), invitation)
+	if mongo.IsDuplicateKeyError(err) {
+		var pending model.Invitation
+		filter := bson.M{"chatroom_id": invitation.ChatRoomID, "user_id": invitation.UserID, "status": model.InvitationPending}
+		err = realTimeChat.invitationCollection.FindOne(context.TODO(), filter).Decode(&pending)
+		if err != nil {
+			return invitation, notFound(err)
+		}
+		return pending, ErrAlreadyInvited
+	}
+	if err != nil {
+		return invitation, err
+	}
+
+	return invitation, nil
+}
+
+// FindInvitationByID - Find invitation by id
+func (realTimeChat *RealTimeChatRepository) FindInvitationByID(id primitive.ObjectID) (model.Invitation, error) {
+
+	var invitation model.Invitation
+
+	err := realTimeChat.invitationCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&invitation)
+	if err != nil {
+		return invitation, notFound(err)
+	}
+
+	return invitation, nil
+}
+
+// FindPendingInvitations - Finds the pending invitations of the user oldest first
+func (realTimeChat *RealTimeChatRepository) FindPendingInvitations(userID primitive.ObjectID) ([]model.Invitation, error) {
+
+	invitations := []model.Invitation{}
+
+	filter := bson.M{"user_id": userID, "status": model.InvitationPending}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	cur, err := realTimeChat.invitationCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var invitation model.Invitation
+		err := cur.Decode(&invitation)
+		if err != nil {
+			return nil, err
+		}
+
+		//appending invitations
+		invitations = append(invitations, invitation)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// RespondInvitation - Accepts or declines a pending invitation, an invitation
+// that is not pending anymore returns ErrNotFound
+func (realTimeChat *RealTimeChatRepository) RespondInvitation(id primitive.ObjectID, status string) (model.Invitation, error) {
+
+	var invitation model.Invitation
+
+	//only a pending invitation can be answered, and only once
+	filter := bson.M{"_id": id, "status": model.InvitationPending}
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	update := bson.M{"$set": bson.M{"status": status, "responded_at": time.Now().UTC()}}
+
+	err := realTimeChat.invitationCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&invitation)
+	if err != nil {
+		return invitation, notFound(err)
+	}
+
+	return invitation, nil
+}
+
+// activeInviteLinkFilter - matches the invite links that can still be redeemed
+// at the given time, see model.InviteLink.Active
+func activeInviteLinkFilter(now time.Time) bson.M {
+	return bson.M{
+		"revoked_at": bson.M{"$exists": false},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"expires_at": bson.M{"$exists": false}},
+				bson.M{"expires_at": bson.M{"$gt": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"max_uses": bson.M{"$exists": false}},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}},
+			}},
+		},
+	}
+}
+
+// CreateInviteLink - Inserts the invite link stamped with the creation time
+func (realTimeChat *RealTimeChatRepository) CreateInviteLink(link model.InviteLink) (model.InviteLink, error) {
+
+	link.ID = primitive.NewObjectID()
+	link.CreatedAt = time.Now().UTC()
+	link.Uses = 0
+
 	//insert into mongodb
-	result, err := messageCollection.InsertOne(context.TODO(), message)
+	_, err := realTimeChat.inviteLinkCollection.InsertOne(context.TODO(), link)
+	if err != nil {
+		return link, err
+	}
+
+	return link, nil
+}
+
+// FindInviteLinkByCode - Find invite link by code, active or not
+func (realTimeChat *RealTimeChatRepository) FindInviteLinkByCode(code string) (model.InviteLink, error) {
+
+	var link model.InviteLink
+
+	err := realTimeChat.inviteLinkCollection.FindOne(context.TODO(), bson.M{"code": code}).Decode(&link)
 	if err != nil {
+		return link, notFound(err)
+	}
+
+	return link, nil
+}
+
+// FindActiveInviteLinks - Finds the invite links of a chat room that can still
+// be redeemed at the given time, oldest first
+func (realTimeChat *RealTimeChatRepository) FindActiveInviteLinks(roomID primitive.ObjectID, now time.Time) ([]model.InviteLink, error) {
+
+	links := []model.InviteLink{}
+
+	filter := activeInviteLinkFilter(now)
+	filter["chatroom_id"] = roomID
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	cur, err := realTimeChat.inviteLinkCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+
+		var link model.InviteLink
+		err := cur.Decode(&link)
+		if err != nil {
+			return nil, err
+		}
+
+		//appending invite links
+		links = append(links, link)
+	}
+
+	if err := cur.Err(); err != nil {
 		return nil, err
 	}
 
-	return result.InsertedID, nil
+	return links, nil
+}
+
+// UseInviteLink - Counts a use of the invite link, an invite link that can not
+// be redeemed at the given time anymore returns ErrNotFound
+func (realTimeChat *RealTimeChatRepository) UseInviteLink(code string, now time.Time) (model.InviteLink, error) {
+
+	var link model.InviteLink
+
+	//checked and counted at once, concurrent uses can not exceed max_uses
+	filter := activeInviteLinkFilter(now)
+	filter["code"] = code
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	update := bson.M{"$inc": bson.M{"uses": 1}}
+
+	err := realTimeChat.inviteLinkCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&link)
+	if err != nil {
+		return link, notFound(err)
+	}
+
+	return link, nil
+}
+
+// RevokeInviteLink - Revokes an invite link of the chat room, an invite link
+// already revoked returns ErrNotFound
+func (realTimeChat *RealTimeChatRepository) RevokeInviteLink(roomID primitive.ObjectID, code string) (model.InviteLink, error) {
+
+	var link model.InviteLink
+
+	filter := bson.M{"chatroom_id": roomID, "code": code, "revoked_at": bson.M{"$exists": false}}
+
+	//to return updated document
+	after := options.After
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}
+
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}}
+
+	err := realTimeChat.inviteLinkCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&link)
+	if err != nil {
+		return link, notFound(err)
+	}
+
+	return link, nil
+}
+
+// UpdateReadMarker - Moves the read marker of the user in the chat room forward
+// to the given message, creating it on the first read. A marker already at or
+// after the message is left as is and returned with ErrReadMarkerBehind.
+func (realTimeChat *RealTimeChatRepository) UpdateReadMarker(marker model.ReadMarker) (model.ReadMarker, error) {
+
+	var updated model.ReadMarker
+
+	marker.UpdatedAt = time.Now().UTC()
+
+	//filter by user and chat room, only markers behind the message match
+	filter := bson.M{
+		"chatroom_id": marker.ChatRoomID,
+		"user_id":     marker.UserID,
+		"seq":         bson.M{"$lt": marker.Seq},
+	}
+
+	//to return updated document, creating it on the first read
+	after := options.After
+	upsert := true
+
+	returnOpt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	update := bson.M{"$set": bson.M{
+		"message_id": marker.MessageID,
+		"seq":        marker.Seq,
+		"updated_at": marker.UpdatedAt,
+	}}
+
+	err := realTimeChat.readMarkerCollection.FindOneAndUpdate(context.TODO(), filter, update, &returnOpt).Decode(&updated)
+	if mongo.IsDuplicateKeyError(err) {
+		//the marker exists and is not behind the message
+		current, err := realTimeChat.FindReadMarker(marker.ChatRoomID, marker.UserID)
+		if err != nil {
+			return marker, err
+		}
+		return current, ErrReadMarkerBehind
+	}
+	if err != nil {
+		return marker, err
+	}
+
+	return updated, nil
+}
+
+// FindReadMarker - Find the read marker of the user in the chat room
+func (realTimeChat *RealTimeChatRepository) FindReadMarker(roomID primitive.ObjectID, userID primitive.ObjectID) (model.ReadMarker, error) {
+
+	var marker model.ReadMarker
+
+	//filter by the unique user and chat room index
+	filter := bson.M{"chatroom_id": roomID, "user_id": userID}
+
+	err := realTimeChat.readMarkerCollection.FindOne(context.TODO(), filter).Decode(&marker)
+	if err != nil {
+		return marker, notFound(err)
+	}
+
+	return marker, nil
+}
+
+// CountUnreadMessages - Counts the messages of a chat room with a sequence number
+// greater than afterSeq sent by other users than the given one, deleted
+// messages are not counted
+func (realTimeChat *RealTimeChatRepository) CountUnreadMessages(roomID primitive.ObjectID, userID primitive.ObjectID, afterSeq int64) (int64, error) {
+
+	//filter by chat room, sequence number and sender
+	filter := bson.M{
+		"chatroom_id": roomID,
+		"seq":         bson.M{"$gt": afterSeq},
+		"user_id":     bson.M{"$ne": userID},
+		"deleted":     bson.M{"$ne": true},
+	}
+
+	count, err := realTimeChat.messageCollection.CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
 }
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ErrNotFound - returned when the requested document does not exist
+var ErrNotFound = errors.New("document not found")
+
+// ErrDuplicateMessage - a message with the same client message id was already
+// stored by the user in the chat room, the stored message is returned with it
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// ErrReadMarkerBehind - the read marker of the user is already at or after the
+// given message, the current marker is returned with it
+var ErrReadMarkerBehind = errors.New("read marker is already past the message")
+
+// ErrAlreadyMember - the user is already a member of the chat room, the current
+// membership is returned with it
+var ErrAlreadyMember = errors.New("already a member of the chat room")
+
+// ErrAlreadyInvited - the user already has a pending invitation to the chat
+// room, the pending invitation is returned with it
+var ErrAlreadyInvited = errors.New("already invited to the chat room")
+
+// directKey - unique key of the direct chat room of two users, the same
+// whatever the order of the users
+func directKey(userID primitive.ObjectID, otherUserID primitive.ObjectID) (string, []primitive.ObjectID) {
+
+	members := []primitive.ObjectID{userID, otherUserID}
+	if userID.Hex() > otherUserID.Hex() {
+		members[0], members[1] = otherUserID, userID
+	}
+
+	return members[0].Hex() + ":" + members[1].Hex(), members
+}
+
+// Repository - storage of chat rooms, users and messages
+type Repository interface {
+	//chat rooms
+	CreateChatRoom(chatRoom model.ChatRoom) (primitive.ObjectID, error)
+	FindAllChatRooms(userID primitive.ObjectID) ([]model.ChatRoom, error)
+	FindChatRoomByID(id primitive.ObjectID) (model.ChatRoom, error)
+	UpdateChatRoom(chatRoom model.ChatRoom) (model.ChatRoom, error)
+	DeleteChatRoom(id primitive.ObjectID) (int64, error)
+	CountChatRoomByChatName(name string) (int64, error)
+	CountChatRoomByID(id primitive.ObjectID) (int64, error)
+	FindOrCreateDirectChatRoom(userID primitive.ObjectID, otherUserID primitive.ObjectID) (model.ChatRoom, error)
+
+	//users
+	CreateUser(user model.User) (primitive.ObjectID, error)
+	FindUserByID(id primitive.ObjectID) (model.User, error)
+	FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error)
+	UpdateUser(user model.User) (model.User, error)
+	FindUserByUsername(username string) (model.User, error)
+	CountUserByUsername(username string) (int64, error)
+
+	//messages
+	CreateMessage(message model.Message) (model.Message, error)
+	FindMessagesByChatRoomID(roomID primitive.ObjectID, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error)
+	FindMessageByID(id primitive.ObjectID) (model.Message, error)
+	FindReplies(parentID primitive.ObjectID, before primitive.ObjectID, after primitive.ObjectID, limit int64) ([]model.Message, error)
+	AddReply(parentID primitive.ObjectID, replyAt time.Time) (model.Message, error)
+	FindMessagesAfterSeq(roomID primitive.ObjectID, afterSeq int64, limit int64) ([]model.Message, error)
+	EditMessage(id primitive.ObjectID, body string) (model.Message, error)
+	DeleteMessage(id primitive.ObjectID) (model.Message, error)
+	AddReaction(id primitive.ObjectID, reaction model.Reaction) (model.Message, error)
+	RemoveReaction(id primitive.ObjectID, reaction model.Reaction) (model.Message, error)
+
+	//memberships
+	AddMember(membership model.Membership) (model.Membership, error)
+	FindMember(roomID primitive.ObjectID, userID primitive.ObjectID) (model.Membership, error)
+	FindMembers(roomID primitive.ObjectID) ([]model.Membership, error)
+	UpdateMemberRole(roomID primitive.ObjectID, userID primitive.ObjectID, role string) (model.Membership, error)
+	RemoveMember(roomID primitive.ObjectID, userID primitive.ObjectID) (int64, error)
+
+	//invitations
+	CreateInvitation(invitation model.Invitation) (model.Invitation, error)
+	FindInvitationByID(id primitive.ObjectID) (model.Invitation, error)
+	FindPendingInvitations(userID primitive.ObjectID) ([]model.Invitation, error)
+	RespondInvitation(id primitive.ObjectID, status string) (model.Invitation, error)
+
+	//invite links
+	CreateInviteLink(link model.InviteLink) (model.InviteLink, error)
+	FindInviteLinkByCode(code string) (model.InviteLink, error)
+	FindActiveInviteLinks(roomID primitive.ObjectID, now time.Time) ([]model.InviteLink, error)
+	UseInviteLink(code string, now time.Time) (model.InviteLink, error)
+	RevokeInviteLink(roomID primitive.ObjectID, code string) (model.InviteLink, error)
+
+	//read markers
+	UpdateReadMarker(marker model.ReadMarker) (model.ReadMarker, error)
+	FindReadMarker(roomID primitive.ObjectID, userID primitive.ObjectID) (model.ReadMarker, error)
+	CountUnreadMessages(roomID primitive.ObjectID, userID primitive.ObjectID, afterSeq int64) (int64, error)
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"context"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// forEachRepository - runs the test against the in-memory repository and, when
+// TEST_MONGODB_URI is set, against a throwaway database of that mongodb server
+// so both implementations are held to the same behaviour
+func forEachRepository(t *testing.T, test func(t *testing.T, repository Repository)) {
+
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryRepository())
+	})
+
+	t.Run("mongodb", func(t *testing.T) {
+		uri := os.Getenv("TEST_MONGODB_URI")
+		if uri == "" {
+			t.Skip("TEST_MONGODB_URI is not set")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			t.Fatalf("connecting to %s: %v", uri, err)
+		}
+
+		db := client.Database("realtime_chat_test_" + primitive.NewObjectID().Hex())
+		t.Cleanup(func() {
+			db.Drop(context.Background())
+			client.Disconnect(context.Background())
+		})
+
+		for _, index := range uniqueIndexes {
+			opts := options.Index().SetUnique(true)
+			if index.partial != nil {
+				opts.SetPartialFilterExpression(index.partial)
+			}
+			_, err := db.Collection(index.collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: index.keys, Options: opts})
+			if err != nil {
+				t.Fatalf("creating index of %s: %v", index.collection, err)
+			}
+		}
+
+		test(t, newRealTimeChatRepository(db))
+	})
+}
+
+// uniqueIndexes - unique indexes of mongo-init.js the repository relies on
+var uniqueIndexes = []struct {
+	collection string
+	keys       bson.D
+	partial    bson.M
+}{
+	{collection: "messages", keys: bson.D{{Key: "chatroom_id", Value: 1}, {Key: "seq", Value: 1}}, partial: bson.M{"seq": bson.M{"$exists": true}}},
+	{collection: "messages", keys: bson.D{{Key: "chatroom_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "client_message_id", Value: 1}}, partial: bson.M{"client_message_id": bson.M{"$exists": true}}},
+	{collection: "read_markers", keys: bson.D{{Key: "chatroom_id", Value: 1}, {Key: "user_id", Value: 1}}},
+	{collection: "chat_rooms", keys: bson.D{{Key: "direct_key", Value: 1}}, partial: bson.M{"direct_key": bson.M{"$exists": true}}},
+	{collection: "memberships", keys: bson.D{{Key: "chatroom_id", Value: 1}, {Key: "user_id", Value: 1}}},
+	{collection: "invitations", keys: bson.D{{Key: "chatroom_id", Value: 1}, {Key: "user_id", Value: 1}}, partial: bson.M{"status": "pending"}},
+	{collection: "invite_links", keys: bson.D{{Key: "code", Value: 1}}},
+}
+
+// createMessages - posts n messages of the user in the chat room, oldest first
+func createMessages(t *testing.T, repository Repository, roomID primitive.ObjectID, userID primitive.ObjectID, n int) []model.Message {
+	t.Helper()
+
+	messages := make([]model.Message, n)
+	for i := range messages {
+		message, err := repository.CreateMessage(model.Message{ChatRoomID: roomID, UserID: userID, Body: "message"})
+		if err != nil {
+			t.Fatalf("creating message %d: %v", i, err)
+		}
+		messages[i] = message
+	}
+
+	return messages
+}
+
+// messageSeqs - sequence numbers of the messages in order
+func messageSeqs(messages []model.Message) []int64 {
+
+	seqs := make([]int64, len(messages))
+	for i, message := range messages {
+		seqs[i] = message.Seq
+	}
+
+	return seqs
+}
+
+// equalSeqs - the two lists have the same sequence numbers in the same order
+func equalSeqs(a []int64, b []int64) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestFindMessagesByChatRoomIDPaging(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository Repository) {
+
+		roomID := primitive.NewObjectID()
+		messages := createMessages(t, repository, roomID, primitive.NewObjectID(), 5)
+		none := primitive.NilObjectID
+
+		tests := []struct {
+			name   string
+			before primitive.ObjectID
+			after  primitive.ObjectID
+			limit  int64
+			want   []int64
+		}{
+			{name: "latest", before: none, after: none, limit: 2, want: []int64{5, 4}},
+			{name: "all", before: none, after: none, limit: 10, want: []int64{5, 4, 3, 2, 1}},
+			{name: "before", before: messages[3].ID, after: none, limit: 2, want: []int64{3, 2}},
+			{name: "before first", before: messages[0].ID, after: none, limit: 2, want: []int64{}},
+			{name: "after", before: none, after: messages[1].ID, limit: 2, want: []int64{4, 3}},
+			{name: "after last", before: none, after: messages[4].ID, limit: 2, want: []int64{}},
+			{name: "between", before: messages[4].ID, after: messages[0].ID, limit: 10, want: []int64{4, 3, 2}},
+			{name: "between limited", before: messages[4].ID, after: messages[0].ID, limit: 2, want: []int64{4, 3}},
+		}
+
+		for _, test := range tests {
+			page, err := repository.FindMessagesByChatRoomID(roomID, test.before, test.after, test.limit)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if got := messageSeqs(page); !equalSeqs(got, test.want) {
+				t.Errorf("%s: got seqs %v, want %v", test.name, got, test.want)
+			}
+		}
+	})
+}
+
+func TestCreateMessageDuplicate(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository Repository) {
+
+		roomID := primitive.NewObjectID()
+		userID := primitive.NewObjectID()
+		message := model.Message{ChatRoomID: roomID, UserID: userID, Body: "hello", ClientMessageID: "c1"}
+
+		original, err := repository.CreateMessage(message)
+		if err != nil {
+			t.Fatalf("creating message: %v", err)
+		}
+
+		resent, err := repository.CreateMessage(message)
+		if err != ErrDuplicateMessage {
+			t.Fatalf("resending message: got error %v, want ErrDuplicateMessage", err)
+		}
+		if resent.ID != original.ID || resent.Seq != original.Seq {
+			t.Fatalf("resending message: got %s seq %d, want %s seq %d", resent.ID.Hex(), resent.Seq, original.ID.Hex(), original.Seq)
+		}
+
+		//the client message id is only unique per user
+		other, err := repository.CreateMessage(model.Message{ChatRoomID: roomID, UserID: primitive.NewObjectID(), Body: "hello", ClientMessageID: "c1"})
+		if err != nil {
+			t.Fatalf("creating message of another user: %v", err)
+		}
+
+		//the duplicate did not use up a sequence number
+		if other.Seq != original.Seq+1 {
+			t.Fatalf("message after the duplicate has seq %d, want %d", other.Seq, original.Seq+1)
+		}
+	})
+}
+
+func TestCreateMessageConcurrentDuplicates(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository Repository) {
+
+		const copies = 20
+
+		roomID := primitive.NewObjectID()
+		message := model.Message{ChatRoomID: roomID, UserID: primitive.NewObjectID(), Body: "hello", ClientMessageID: "c1"}
+
+		results := make([]model.Message, copies)
+		errs := make([]error, copies)
+		var wg sync.WaitGroup
+		for i := 0; i < copies; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], errs[i] = repository.CreateMessage(message)
+			}(i)
+		}
+		wg.Wait()
+
+		stored := 0
+		for i, err := range errs {
+			switch err {
+			case nil:
+				stored++
+			case ErrDuplicateMessage:
+			default:
+				t.Fatalf("copy %d: %v", i, err)
+			}
+			if results[i].ID != results[0].ID || results[i].Seq != 1 {
+				t.Fatalf("copy %d returned %s seq %d, want %s seq 1", i, results[i].ID.Hex(), results[i].Seq, results[0].ID.Hex())
+			}
+		}
+		if stored != 1 {
+			t.Fatalf("%d copies stored, want 1", stored)
+		}
+
+		//the copies did not use up sequence numbers
+		next := createMessages(t, repository, roomID, primitive.NewObjectID(), 1)[0]
+		if next.Seq != 2 {
+			t.Fatalf("next message has seq %d, want 2", next.Seq)
+		}
+	})
+}
+
+func TestUpdateReadMarkerOnlyMovesForward(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository Repository) {
+
+		roomID := primitive.NewObjectID()
+		userID := primitive.NewObjectID()
+		messages := createMessages(t, repository, roomID, primitive.NewObjectID(), 4)
+
+		marker := func(message model.Message) model.ReadMarker {
+			return model.ReadMarker{ChatRoomID: roomID, UserID: userID, MessageID: message.ID, Seq: message.Seq}
+		}
+
+		if _, err := repository.UpdateReadMarker(marker(messages[2])); err != nil {
+			t.Fatalf("first read: %v", err)
+		}
+
+		for _, message := range messages[1:3] {
+			current, err := repository.UpdateReadMarker(marker(message))
+			if err != ErrReadMarkerBehind {
+				t.Fatalf("reading seq %d after seq 3: got error %v, want ErrReadMarkerBehind", message.Seq, err)
+			}
+			if current.Seq != 3 {
+				t.Fatalf("reading seq %d after seq 3: current marker at seq %d, want 3", message.Seq, current.Seq)
+			}
+		}
+
+		if _, err := repository.UpdateReadMarker(marker(messages[3])); err != nil {
+			t.Fatalf("reading forward: %v", err)
+		}
+
+		current, err := repository.FindReadMarker(roomID, userID)
+		if err != nil {
+			t.Fatalf("finding read marker: %v", err)
+		}
+		if current.Seq != 4 || current.MessageID != messages[3].ID {
+			t.Fatalf("read marker at seq %d, want 4", current.Seq)
+		}
+	})
+}
+
+func TestUseInviteLink(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository Repository) {
+
+		roomID := primitive.NewObjectID()
+		now := time.Now().UTC()
+
+		limited, err := repository.CreateInviteLink(model.InviteLink{ChatRoomID: roomID, Code: "limited", MaxUses: 2})
+		if err != nil {
+			t.Fatalf("creating invite link: %v", err)
+		}
+
+		for want := int64(1); want <= limited.MaxUses; want++ {
+			link, err := repository.UseInviteLink(limited.Code, now)
+			if err != nil {
+				t.Fatalf("use %d: %v", want, err)
+			}
+			if link.Uses != want {
+				t.Fatalf("use %d: invite link has %d uses", want, link.Uses)
+			}
+		}
+
+		if _, err := repository.UseInviteLink(limited.Code, now); err != ErrNotFound {
+			t.Fatalf("use past max_uses: got error %v, want ErrNotFound", err)
+		}
+
+		link, err := repository.FindInviteLinkByCode(limited.Code)
+		if err != nil {
+			t.Fatalf("finding invite link: %v", err)
+		}
+		if link.Uses != limited.MaxUses {
+			t.Fatalf("invite link has %d uses, want %d", link.Uses, limited.MaxUses)
+		}
+
+		expiresAt := now.Add(time.Hour)
+		expiring, err := repository.CreateInviteLink(model.InviteLink{ChatRoomID: roomID, Code: "expiring", ExpiresAt: &expiresAt})
+		if err != nil {
+			t.Fatalf("creating invite link: %v", err)
+		}
+		if _, err := repository.UseInviteLink(expiring.Code, now); err != nil {
+			t.Fatalf("use before expiry: %v", err)
+		}
+		if _, err := repository.UseInviteLink(expiring.Code, expiresAt); err != ErrNotFound {
+			t.Fatalf("use at expiry: got error %v, want ErrNotFound", err)
+		}
+
+		revoked, err := repository.CreateInviteLink(model.InviteLink{ChatRoomID: roomID, Code: "revoked"})
+		if err != nil {
+			t.Fatalf("creating invite link: %v", err)
+		}
+		if _, err := repository.RevokeInviteLink(roomID, revoked.Code); err != nil {
+			t.Fatalf("revoking invite link: %v", err)
+		}
+		if _, err := repository.UseInviteLink(revoked.Code, now); err != ErrNotFound {
+			t.Fatalf("use after revoke: got error %v, want ErrNotFound", err)
+		}
+
+		if _, err := repository.UseInviteLink("unknown", now); err != ErrNotFound {
+			t.Fatalf("use of an unknown code: got error %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestFindUsersByIDs(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repository Repository) {
+
+		ids := []primitive.ObjectID{}
+		for _, name := range []string{"alice", "bob", "carol"} {
+			id, err := repository.CreateUser(model.User{UserName: name})
+			if err != nil {
+				t.Fatalf("creating user %s: %v", name, err)
+			}
+			ids = append(ids, id)
+		}
+
+		//missing and repeated ids are skipped, users come sorted by id
+		users, err := repository.FindUsersByIDs([]primitive.ObjectID{ids[2], primitive.NewObjectID(), ids[0], ids[2]})
+		if err != nil {
+			t.Fatalf("finding users: %v", err)
+		}
+		if len(users) != 2 || users[0].UserName != "alice" || users[1].UserName != "carol" {
+			t.Fatalf("got users %+v, want alice and carol", users)
+		}
+
+		users, err = repository.FindUsersByIDs(nil)
+		if err != nil || users == nil || len(users) != 0 {
+			t.Fatalf("finding no users: got %v, %v, want an empty list", users, err)
+		}
+	})
+}
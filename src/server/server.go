@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/Tainzen/realtime-chat/src/controller"
+	"github.com/Tainzen/realtime-chat/src/hub"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/Tainzen/realtime-chat/utils/config"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"net/http"
+)
+
+// Server - the realtime chat application, every server owns its own
+// dependencies so several of them can run side by side
+type Server struct {
+	config  config.Config
+	logger  zerolog.Logger
+	handler http.Handler
+}
+
+// NewServer - wires the controllers and routes on top of the given dependencies
+func NewServer(cfg config.Config, logger zerolog.Logger, repository repository.Repository, realTimeChatHub *hub.Hub) *Server {
+
+	// Instantiate controllers
+	realTimeChatController := controller.NewRealTimeChatController(cfg, logger, repository, realTimeChatHub)
+
+	route := mux.NewRouter()
+
+	api := route.PathPrefix(cfg.BasePath).Subrouter()
+	//public apis
+	api.HandleFunc(controller.HealthCheckPath, realTimeChatController.HealthCheck).Methods("GET")
+	api.HandleFunc(controller.MetricsPath, realTimeChatController.Metrics).Methods("GET")
+	api.HandleFunc(controller.LoginPath, realTimeChatController.Login).Methods("POST")
+	api.HandleFunc(controller.CreateUserPath, realTimeChatController.CreateUser).Methods("POST")
+
+	//apis requiring a bearer token
+	protected := api.NewRoute().Subrouter()
+	protected.Use(realTimeChatController.AuthMiddleware, realTimeChatController.ChatRoomAccessMiddleware)
+	//chat-rooms apis
+	protected.HandleFunc(controller.CreateChatRoomPath, realTimeChatController.CreateChatRoom).Methods("POST")
+	protected.HandleFunc(controller.CreateDirectChatRoomPath, realTimeChatController.CreateDirectChatRoom).Methods("POST")
+	protected.HandleFunc(controller.GetAllChatRoomsPath, realTimeChatController.GetAllChatRoom).Methods("GET")
+	protected.HandleFunc(controller.GetChatRoomPath, realTimeChatController.GetChatRoom).Methods("GET")
+	protected.HandleFunc(controller.UpdateChatRoomPath, realTimeChatController.UpdateChatRoom).Methods("PUT")
+	protected.HandleFunc(controller.DeleteChatRoomPath, realTimeChatController.DeleteChatRoom).Methods("DELETE")
+	protected.HandleFunc(controller.GetChatRoomMessagesPath, realTimeChatController.GetChatRoomMessages).Methods("GET")
+	//users apis
+	protected.HandleFunc(controller.GetChatRoomOnlinePath, realTimeChatController.GetChatRoomOnline).Methods("GET")
+	protected.HandleFunc(controller.GetMessageRepliesPath, realTimeChatController.GetMessageReplies).Methods("GET")
+	protected.HandleFunc(controller.JoinChatRoomPath, realTimeChatController.JoinChatRoom).Methods("POST")
+	protected.HandleFunc(controller.LeaveChatRoomPath, realTimeChatController.LeaveChatRoom).Methods("DELETE")
+	protected.HandleFunc(controller.GetChatRoomMembersPath, realTimeChatController.GetChatRoomMembers).Methods("GET")
+	protected.HandleFunc(controller.UpdateMemberRolePath, realTimeChatController.UpdateMemberRole).Methods("PUT")
+	protected.HandleFunc(controller.CreateInvitationPath, realTimeChatController.CreateInvitation).Methods("POST")
+	protected.HandleFunc(controller.GetInvitationsPath, realTimeChatController.GetInvitations).Methods("GET")
+	protected.HandleFunc(controller.AcceptInvitationPath, realTimeChatController.AcceptInvitation).Methods("POST")
+	protected.HandleFunc(controller.DeclineInvitationPath, realTimeChatController.DeclineInvitation).Methods("POST")
+	protected.HandleFunc(controller.CreateInviteLinkPath, realTimeChatController.CreateInviteLink).Methods("POST")
+	protected.HandleFunc(controller.GetInviteLinksPath, realTimeChatController.GetInviteLinks).Methods("GET")
+	protected.HandleFunc(controller.RevokeInviteLinkPath, realTimeChatController.RevokeInviteLink).Methods("DELETE")
+	protected.HandleFunc(controller.RedeemInviteLinkPath, realTimeChatController.RedeemInviteLink).Methods("POST")
+	protected.HandleFunc(controller.EditMessagePath, realTimeChatController.EditMessage).Methods("PUT")
+	protected.HandleFunc(controller.DeleteMessagePath, realTimeChatController.DeleteMessage).Methods("DELETE")
+	protected.HandleFunc(controller.AddReactionPath, realTimeChatController.AddReaction).Methods("PUT")
+	protected.HandleFunc(controller.RemoveReactionPath, realTimeChatController.RemoveReaction).Methods("DELETE")
+	protected.HandleFunc(controller.MarkChatRoomReadPath, realTimeChatController.MarkChatRoomRead).Methods("POST")
+	protected.HandleFunc(controller.GetChatRoomUnreadPath, realTimeChatController.GetChatRoomUnread).Methods("GET")
+	protected.HandleFunc(controller.GetUserPath, realTimeChatController.GetUser).Methods("GET")
+	protected.HandleFunc(controller.UpdateUserPath, realTimeChatController.UpdateUser).Methods("PUT")
+	//chat-room-websocker apis
+	api.HandleFunc(controller.ChatRoomWebsocket, realTimeChatController.WebSocketHandler).Methods("GET")
+
+	return &Server{
+		config:  cfg,
+		logger:  logger,
+		handler: route,
+	}
+}
+
+// Handler - http handler serving every api of the server
+func (server *Server) Handler() http.Handler {
+	return server.handler
+}
+
+// ListenAndServe - serves the apis on the configured port
+func (server *Server) ListenAndServe() error {
+
+	server.logger.Info().Msgf("Listening on %s", server.config.Port)
+
+	return http.ListenAndServe(server.config.Port, server.handler)
+}
@@ -0,0 +1,1234 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Tainzen/realtime-chat/src/hub"
+	"github.com/Tainzen/realtime-chat/src/model"
+	"github.com/Tainzen/realtime-chat/src/protocol"
+	"github.com/Tainzen/realtime-chat/src/repository"
+	"github.com/Tainzen/realtime-chat/utils/auth"
+	"github.com/Tainzen/realtime-chat/utils/config"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// frameTimeout - longest wait for an expected websocket frame
+const frameTimeout = 10 * time.Second
+
+// testServer - server running on top of a test repository
+type testServer struct {
+	*httptest.Server
+	repository repository.Repository
+	hub        *hub.Hub
+	config     config.Config
+}
+
+// testUser - user logged into a testServer
+type testUser struct {
+	id    string
+	token string
+}
+
+// newTestServer - starts an isolated server on an in-memory repository, closed
+// at the end of the test
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWith(t, repository.NewMemoryRepository())
+}
+
+// newTestServerWith - same as newTestServer on top of the given repository
+func newTestServerWith(t *testing.T, realTimeChatRepository repository.Repository) *testServer {
+	return newTestServerFrom(t, testConfig(), realTimeChatRepository)
+}
+
+// testConfig - config of the test servers
+func testConfig() config.Config {
+	return config.Config{
+		BasePath:        "/api",
+		Repository:      "memory",
+		AuthSecret:      "test-secret",
+		TokenTTL:        time.Hour,
+		PingInterval:    time.Minute,
+		PongWait:        2 * time.Minute,
+		WriteTimeout:    10 * time.Second,
+		SendQueueSize:   256,
+		OverflowPolicy:  "block",
+		OverflowTimeout: time.Second,
+		TypingThrottle:  3 * time.Second,
+		TypingTimeout:   10 * time.Second,
+	}
+}
+
+// newTestServerFrom - same as newTestServerWith with the given config
+func newTestServerFrom(t *testing.T, cfg config.Config, realTimeChatRepository repository.Repository) *testServer {
+
+	realTimeChatHub := hub.NewHub(hub.Config{
+		PingInterval:    cfg.PingInterval,
+		PongWait:        cfg.PongWait,
+		WriteWait:       cfg.WriteTimeout,
+		SendQueueSize:   cfg.SendQueueSize,
+		OverflowPolicy:  hub.OverflowPolicy(cfg.OverflowPolicy),
+		OverflowTimeout: cfg.OverflowTimeout,
+	})
+
+	srv := NewServer(cfg, zerolog.Nop(), realTimeChatRepository, realTimeChatHub)
+
+	ts := &testServer{
+		Server:     httptest.NewServer(srv.Handler()),
+		repository: realTimeChatRepository,
+		hub:        realTimeChatHub,
+		config:     cfg,
+	}
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// call - sends a json request to the api at path, decodes the response into
+// out when given and returns the status code
+func (ts *testServer) call(t *testing.T, method string, path string, token string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encoding %s %s: %v", method, path, err)
+		}
+	}
+
+	req, err := http.NewRequest(method, ts.URL+ts.config.BasePath+path, &payload)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("decoding %s %s: %v", method, path, err)
+		}
+	}
+
+	return res.StatusCode
+}
+
+// expect - same as call, failing the test unless the status code is want
+func (ts *testServer) expect(t *testing.T, want int, method string, path string, token string, body interface{}, out interface{}) {
+	t.Helper()
+
+	if status := ts.call(t, method, path, token, body, out); status != want {
+		t.Fatalf("%s %s: status %d, want %d", method, path, status, want)
+	}
+}
+
+// newUser - creates the user and logs it in
+func (ts *testServer) newUser(t *testing.T, name string) testUser {
+	t.Helper()
+
+	credentials := map[string]string{"username": name, "password": "password"}
+	ts.expect(t, http.StatusOK, "POST", "/users", "", credentials, nil)
+
+	var login struct {
+		Token  string `json:"token"`
+		UserID string `json:"user_id"`
+	}
+	ts.expect(t, http.StatusOK, "POST", "/auth/login", "", credentials, &login)
+
+	return testUser{id: login.UserID, token: login.Token}
+}
+
+// newRoom - creates a public chat room owned by the user
+func (ts *testServer) newRoom(t *testing.T, owner testUser, name string) string {
+	t.Helper()
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	ts.expect(t, http.StatusOK, "POST", "/chat-rooms", owner.token, map[string]string{"name": name}, &created)
+
+	return created.ID
+}
+
+// connect - opens a websocket of the user to the chat room, query is appended
+// to the url when not empty. The status code of the handshake is returned with
+// the error.
+func (ts *testServer) connect(user testUser, roomID string, query string) (*websocket.Conn, int, error) {
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + ts.config.BasePath + "/ws/chat-room/" + roomID
+	if query != "" {
+		url += "?" + query
+	}
+
+	header := http.Header{"Authorization": []string{"Bearer " + user.token}}
+	conn, res, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		status := 0
+		if res != nil {
+			status = res.StatusCode
+		}
+		return nil, status, err
+	}
+
+	return conn, res.StatusCode, nil
+}
+
+// dial - same as connect, failing the test unless the websocket is opened. It
+// is closed at the end of the test.
+func (ts *testServer) dial(t *testing.T, user testUser, roomID string, query string) *websocket.Conn {
+	t.Helper()
+
+	conn, status, err := ts.connect(user, roomID, query)
+	if err != nil {
+		t.Fatalf("dialing room %s: %v (status %d)", roomID, err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// waitClients - waits until the hub has n connected clients
+func (ts *testServer) waitClients(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(frameTimeout)
+	for ts.hub.Stats().Clients != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("hub has %d clients, want %d", ts.hub.Stats().Clients, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sendFrame - writes a frame of the type with the payload on the websocket
+func sendFrame(conn *websocket.Conn, frameType string, id string, payload protocol.Payload) error {
+
+	envelope, err := protocol.NewEnvelope(frameType, id, "", payload)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteJSON(envelope)
+}
+
+// readFrame - reads the next frame of the websocket, an error ends the
+// connection since gorilla does not recover from read timeouts
+func readFrame(conn *websocket.Conn) (protocol.Envelope, protocol.Payload, error) {
+
+	conn.SetReadDeadline(time.Now().Add(frameTimeout))
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return protocol.Envelope{}, nil, err
+	}
+
+	return protocol.Decode(data)
+}
+
+// readUntil - reads frames until one of the type is received, the others are
+// skipped
+func readUntil(t *testing.T, conn *websocket.Conn, frameType string) (protocol.Envelope, protocol.Payload) {
+	t.Helper()
+
+	for {
+		envelope, payload, err := readFrame(conn)
+		if err != nil {
+			t.Fatalf("waiting for a %s frame: %v", frameType, err)
+		}
+		if envelope.Type == frameType {
+			return envelope, payload
+		}
+	}
+}
+
+// TestConcurrentRooms - hundreds of websockets across many rooms join, post
+// and leave concurrently, every client receives every message of its room
+// exactly once and the rooms are torn down once empty. Meant to be run with the
+// race detector.
+func TestConcurrentRooms(t *testing.T) {
+
+	const (
+		rooms           = 20
+		users           = 10
+		clientsPerUser  = 2
+		messagesPerConn = 3
+		clientsPerRoom  = users * clientsPerUser
+		messagesPerRoom = clientsPerRoom * messagesPerConn
+	)
+
+	ts := newTestServer(t)
+
+	members := make([]testUser, users)
+	for i := range members {
+		members[i] = ts.newUser(t, fmt.Sprintf("user%d", i))
+	}
+
+	roomIDs := make([]string, rooms)
+	for i := range roomIDs {
+		roomIDs[i] = ts.newRoom(t, members[0], fmt.Sprintf("room%d", i))
+		for _, member := range members[1:] {
+			ts.expect(t, http.StatusOK, "POST", "/chat-rooms/"+roomIDs[i]+"/members", member.token, nil, nil)
+		}
+	}
+
+	type client struct {
+		roomID string
+		conn   *websocket.Conn
+	}
+
+	//connect everybody at once
+	clients := make([]client, 0, rooms*clientsPerRoom)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, roomID := range roomIDs {
+		for _, member := range members {
+			for i := 0; i < clientsPerUser; i++ {
+				wg.Add(1)
+				go func(roomID string, member testUser) {
+					defer wg.Done()
+					conn, _, err := ts.connect(member, roomID, "")
+					if err != nil {
+						t.Errorf("dialing room %s: %v", roomID, err)
+						return
+					}
+					mu.Lock()
+					clients = append(clients, client{roomID: roomID, conn: conn})
+					mu.Unlock()
+				}(roomID, member)
+			}
+		}
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	ts.waitClients(t, rooms*clientsPerRoom)
+	if got := ts.hub.RoomCount(); got != rooms {
+		t.Fatalf("hub has %d rooms, want %d", got, rooms)
+	}
+
+	//everybody posts at once and reads every message of its room
+	for n, c := range clients {
+		wg.Add(1)
+		go func(n int, c client) {
+			defer wg.Done()
+
+			for i := 0; i < messagesPerConn; i++ {
+				body := fmt.Sprintf("message %d of client %d", i, n)
+				if err := sendFrame(c.conn, protocol.TypeMessage, body, &protocol.MessagePayload{Body: body}); err != nil {
+					t.Errorf("client %d: sending: %v", n, err)
+					return
+				}
+			}
+
+			seen := make(map[int64]bool, messagesPerRoom)
+			for received := 0; received < messagesPerRoom; {
+				envelope, payload, err := readFrame(c.conn)
+				if err != nil {
+					t.Errorf("client %d: received %d of %d messages: %v", n, received, messagesPerRoom, err)
+					return
+				}
+				if envelope.Type != protocol.TypeMessage {
+					continue
+				}
+
+				message := payload.(*protocol.MessagePayload)
+				if envelope.RoomID != c.roomID {
+					t.Errorf("client %d: message of room %s, want %s", n, envelope.RoomID, c.roomID)
+				}
+				if message.Seq < 1 || message.Seq > messagesPerRoom || seen[message.Seq] {
+					t.Errorf("client %d: unexpected message seq %d", n, message.Seq)
+				}
+				seen[message.Seq] = true
+				received++
+			}
+		}(n, c)
+	}
+	wg.Wait()
+
+	//everybody leaves at once
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c client) {
+			defer wg.Done()
+			c.conn.Close()
+		}(c)
+	}
+	wg.Wait()
+
+	ts.waitClients(t, 0)
+	if got := ts.hub.RoomCount(); got != 0 {
+		t.Fatalf("hub has %d rooms after everybody left, want 0", got)
+	}
+}
+
+// TestUpdateChatRoomIgnoresBodyID - the room id in the body of a rename does
+// not redirect it to a chat room the caller does not manage
+func TestUpdateChatRoomIgnoresBodyID(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	mallory := ts.newUser(t, "mallory")
+
+	aliceRoom := ts.newRoom(t, alice, "alice-room")
+	malloryRoom := ts.newRoom(t, mallory, "mallory-room")
+
+	rename := map[string]string{"_id": aliceRoom, "name": "renamed"}
+	ts.expect(t, http.StatusOK, "PUT", "/chat-rooms/"+malloryRoom, mallory.token, rename, nil)
+
+	var room struct {
+		Name string `json:"name"`
+	}
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+aliceRoom, alice.token, nil, &room)
+	if room.Name != "alice-room" {
+		t.Fatalf("alice's chat room is named %q, want %q", room.Name, "alice-room")
+	}
+
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+malloryRoom, mallory.token, nil, &room)
+	if room.Name != "renamed" {
+		t.Fatalf("mallory's chat room is named %q, want %q", room.Name, "renamed")
+	}
+}
+
+// postMessage - sends a chat message with the client message id on the
+// websocket and returns its ack
+func postMessage(t *testing.T, conn *websocket.Conn, clientMessageID string, body string) *protocol.AckPayload {
+	t.Helper()
+
+	err := sendFrame(conn, protocol.TypeMessage, clientMessageID, &protocol.MessagePayload{ClientMessageID: clientMessageID, Body: body})
+	if err != nil {
+		t.Fatalf("sending message %s: %v", clientMessageID, err)
+	}
+
+	_, payload := readUntil(t, conn, protocol.TypeAck)
+
+	return payload.(*protocol.AckPayload)
+}
+
+// TestResentMessageStoredOnce - a message resent with the same client message
+// id is acked with the stored message and neither stored nor broadcasted again
+func TestResentMessageStoredOnce(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	roomID := ts.newRoom(t, alice, "room")
+
+	sender := ts.dial(t, alice, roomID, "")
+	watcher := ts.dial(t, bob, roomID, "")
+	ts.waitClients(t, 2)
+
+	original := postMessage(t, sender, "c1", "hello")
+	if original.Duplicate || original.Seq != 1 {
+		t.Fatalf("first ack: duplicate %v seq %d, want a new message with seq 1", original.Duplicate, original.Seq)
+	}
+
+	resent := postMessage(t, sender, "c1", "hello")
+	if !resent.Duplicate || resent.MessageID != original.MessageID || resent.Seq != original.Seq {
+		t.Fatalf("resent ack: duplicate %v message %s seq %d, want duplicate of %s seq %d", resent.Duplicate, resent.MessageID, resent.Seq, original.MessageID, original.Seq)
+	}
+
+	next := postMessage(t, sender, "c2", "world")
+	if next.Duplicate || next.Seq != 2 {
+		t.Fatalf("next ack: duplicate %v seq %d, want a new message with seq 2", next.Duplicate, next.Seq)
+	}
+
+	//the watcher gets the first message once, then the next one
+	for _, want := range []int64{1, 2} {
+		_, payload := readUntil(t, watcher, protocol.TypeMessage)
+		if got := payload.(*protocol.MessagePayload).Seq; got != want {
+			t.Fatalf("watcher received seq %d, want %d", got, want)
+		}
+	}
+
+	var page struct {
+		Messages []struct {
+			ClientMessageID string `json:"client_message_id"`
+		} `json:"messages"`
+	}
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID+"/messages", alice.token, nil, &page)
+	if len(page.Messages) != 2 {
+		t.Fatalf("chat room has %d messages, want 2", len(page.Messages))
+	}
+}
+
+// TestResumeReplaysMissedMessages - a client reconnecting with last_seq or
+// last_message_id first receives the messages it missed in order, then the
+// live ones, without duplicates at the handover
+func TestResumeReplaysMissedMessages(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	roomID := ts.newRoom(t, alice, "room")
+
+	sender := ts.dial(t, alice, roomID, "")
+
+	acks := make([]*protocol.AckPayload, 3)
+	for i := range acks {
+		acks[i] = postMessage(t, sender, fmt.Sprintf("c%d", i+1), "missed")
+	}
+
+	last := acks[len(acks)-1].Seq
+	for _, query := range []string{"last_seq=1", "last_message_id=" + acks[0].MessageID} {
+		resumed := ts.dial(t, bob, roomID, query)
+		ts.waitClients(t, 2)
+
+		for want := int64(2); want <= last; want++ {
+			_, payload := readUntil(t, resumed, protocol.TypeMessage)
+			if got := payload.(*protocol.MessagePayload).Seq; got != want {
+				t.Fatalf("%s: replayed seq %d, want %d", query, got, want)
+			}
+		}
+
+		live := postMessage(t, sender, fmt.Sprintf("live-%s", query), "live")
+		_, payload := readUntil(t, resumed, protocol.TypeMessage)
+		if got := payload.(*protocol.MessagePayload).Seq; got != live.Seq {
+			t.Fatalf("%s: received seq %d after the replay, want %d", query, got, live.Seq)
+		}
+		last = live.Seq
+
+		resumed.Close()
+		ts.waitClients(t, 1)
+	}
+
+	for _, query := range []string{"last_seq=abc", "last_seq=-1"} {
+		if _, status, err := ts.connect(bob, roomID, query); err == nil || status != http.StatusBadRequest {
+			t.Fatalf("resuming with %s: status %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+
+	//0 replays the whole room
+	resumed := ts.dial(t, bob, roomID, "last_seq=0")
+	if _, payload := readUntil(t, resumed, protocol.TypeMessage); payload.(*protocol.MessagePayload).Seq != 1 {
+		t.Fatalf("resuming from 0 replayed %+v first, want seq 1", payload)
+	}
+}
+
+// TestReadReceipts - read markers only move forward, their receipts are
+// broadcasted to the room and the unread count follows them
+// pausedReplay - repository pausing the first replay of missed messages until
+// resume is closed, replaying is closed once it started
+type pausedReplay struct {
+	repository.Repository
+	replaying chan struct{}
+	resume    chan struct{}
+	once      sync.Once
+}
+
+func (repo *pausedReplay) FindMessagesAfterSeq(roomID primitive.ObjectID, afterSeq int64, limit int64) ([]model.Message, error) {
+	repo.once.Do(func() {
+		close(repo.replaying)
+		<-repo.resume
+	})
+	return repo.Repository.FindMessagesAfterSeq(roomID, afterSeq, limit)
+}
+
+func TestResumeLongerThanSendQueue(t *testing.T) {
+
+	cfg := testConfig()
+	cfg.SendQueueSize = 4
+	cfg.OverflowPolicy = "disconnect"
+
+	repo := &pausedReplay{
+		Repository: repository.NewMemoryRepository(),
+		replaying:  make(chan struct{}),
+		resume:     make(chan struct{}),
+	}
+	ts := newTestServerFrom(t, cfg, repo)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	roomID := ts.newRoom(t, alice, "room")
+
+	sender := ts.dial(t, alice, roomID, "")
+
+	//more missed messages than the send queue holds
+	missed := 3 * cfg.SendQueueSize
+	for i := 0; i < missed; i++ {
+		postMessage(t, sender, fmt.Sprintf("missed-%d", i), "missed")
+	}
+
+	resumed := ts.dial(t, bob, roomID, "last_seq=0")
+	select {
+	case <-repo.replaying:
+	case <-time.After(frameTimeout):
+		t.Fatal("replay did not start")
+	}
+
+	//live messages broadcast during the replay overflow the queue unless
+	//they are kept aside until the replay is over
+	live := 2 * cfg.SendQueueSize
+	for i := 0; i < live; i++ {
+		postMessage(t, sender, fmt.Sprintf("live-%d", i), "live")
+	}
+	close(repo.resume)
+
+	//the live messages are stored before the replay reads them, they are
+	//replayed and not written twice
+	total := int64(missed + live)
+	for want := int64(1); want <= total; want++ {
+		_, payload := readUntil(t, resumed, protocol.TypeMessage)
+		if got := payload.(*protocol.MessagePayload).Seq; got != want {
+			t.Fatalf("replayed seq %d, want %d", got, want)
+		}
+	}
+	if _, payload := readUntil(t, resumed, protocol.TypeSystem); payload.(*protocol.SystemPayload).Event != protocol.SystemEventReplayComplete {
+		t.Fatalf("got system event %q after the replay, want %q", payload.(*protocol.SystemPayload).Event, protocol.SystemEventReplayComplete)
+	}
+
+	next := postMessage(t, sender, "after", "after the replay")
+	_, payload := readUntil(t, resumed, protocol.TypeMessage)
+	if got := payload.(*protocol.MessagePayload).Seq; got != next.Seq {
+		t.Fatalf("received seq %d after the replay, want %d", got, next.Seq)
+	}
+
+	if disconnected := ts.hub.Stats().SlowDisconnected; disconnected != 0 {
+		t.Fatalf("hub disconnected %d slow clients, want 0", disconnected)
+	}
+}
+
+func TestReadReceipts(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	mallory := ts.newUser(t, "mallory")
+	roomID := ts.newRoom(t, alice, "room")
+	ts.expect(t, http.StatusOK, "POST", "/chat-rooms/"+roomID+"/members", bob.token, nil, nil)
+
+	sender := ts.dial(t, alice, roomID, "")
+	reader := ts.dial(t, bob, roomID, "")
+	ts.waitClients(t, 2)
+
+	for i := 1; i <= 3; i++ {
+		postMessage(t, sender, fmt.Sprintf("c%d", i), "unread")
+	}
+
+	var status struct {
+		LastReadSeq int64 `json:"last_read_seq"`
+		Unread      int64 `json:"unread"`
+	}
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID+"/unread", bob.token, nil, &status)
+	if status.LastReadSeq != 0 || status.Unread != 3 {
+		t.Fatalf("before reading: last read seq %d unread %d, want 0 and 3", status.LastReadSeq, status.Unread)
+	}
+
+	//the sender does not have its own messages unread
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID+"/unread", alice.token, nil, &status)
+	if status.Unread != 0 {
+		t.Fatalf("sender has %d unread messages, want 0", status.Unread)
+	}
+
+	ts.expect(t, http.StatusOK, "POST", "/chat-rooms/"+roomID+"/read", bob.token, map[string]int64{"seq": 2}, &status)
+	if status.LastReadSeq != 2 || status.Unread != 1 {
+		t.Fatalf("after reading seq 2: last read seq %d unread %d, want 2 and 1", status.LastReadSeq, status.Unread)
+	}
+
+	_, payload := readUntil(t, sender, protocol.TypeRead)
+	receipt := payload.(*protocol.ReadPayload)
+	if receipt.UserID != bob.id || receipt.Seq != 2 {
+		t.Fatalf("receipt of user %s seq %d, want user %s seq 2", receipt.UserID, receipt.Seq, bob.id)
+	}
+
+	//reading backward leaves the marker as is
+	ts.expect(t, http.StatusOK, "POST", "/chat-rooms/"+roomID+"/read", bob.token, map[string]int64{"seq": 1}, &status)
+	if status.LastReadSeq != 2 || status.Unread != 1 {
+		t.Fatalf("after reading seq 1: last read seq %d unread %d, want 2 and 1", status.LastReadSeq, status.Unread)
+	}
+
+	//the same over the websocket
+	if err := sendFrame(reader, protocol.TypeRead, "r1", &protocol.ReadPayload{Seq: 3}); err != nil {
+		t.Fatalf("sending read frame: %v", err)
+	}
+	_, payload = readUntil(t, sender, protocol.TypeRead)
+	if receipt := payload.(*protocol.ReadPayload); receipt.UserID != bob.id || receipt.Seq != 3 {
+		t.Fatalf("receipt of user %s seq %d, want user %s seq 3", receipt.UserID, receipt.Seq, bob.id)
+	}
+
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID+"/unread", bob.token, nil, &status)
+	if status.LastReadSeq != 3 || status.Unread != 0 {
+		t.Fatalf("after reading seq 3: last read seq %d unread %d, want 3 and 0", status.LastReadSeq, status.Unread)
+	}
+
+	//watching a public chat room does not allow to send receipts
+	ts.expect(t, http.StatusForbidden, "POST", "/chat-rooms/"+roomID+"/read", mallory.token, map[string]int64{"seq": 3}, nil)
+}
+
+// TestReactionCounts - every user reacts at most once per emoji, the reactions
+// are broadcasted with their count and returned counted with the history
+func TestReactionCounts(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	mallory := ts.newUser(t, "mallory")
+	roomID := ts.newRoom(t, alice, "room")
+	ts.expect(t, http.StatusOK, "POST", "/chat-rooms/"+roomID+"/members", bob.token, nil, nil)
+
+	watcher := ts.dial(t, alice, roomID, "")
+	ts.waitClients(t, 1)
+
+	messageID := postMessage(t, watcher, "c1", "react to me").MessageID
+	path := "/chat-rooms/" + roomID + "/messages/" + messageID + "/reactions/" + url.PathEscape("👍")
+
+	type reactions struct {
+		Reactions []struct {
+			Emoji   string   `json:"emoji"`
+			Count   int64    `json:"count"`
+			UserIDs []string `json:"user_ids"`
+		} `json:"reactions"`
+	}
+
+	//reactedBy - fails the test unless the thumbs up was given by the users
+	reactedBy := func(what string, got reactions, users ...testUser) {
+		t.Helper()
+		if len(got.Reactions) != 1 || got.Reactions[0].Emoji != "👍" || got.Reactions[0].Count != int64(len(users)) {
+			t.Fatalf("%s: reactions %+v, want 👍 by %d users", what, got.Reactions, len(users))
+		}
+		for i, user := range users {
+			if got.Reactions[0].UserIDs[i] != user.id {
+				t.Fatalf("%s: reaction %d by %s, want %s", what, i, got.Reactions[0].UserIDs[i], user.id)
+			}
+		}
+	}
+
+	var message reactions
+	ts.expect(t, http.StatusOK, "PUT", path, alice.token, nil, &message)
+	reactedBy("alice reacts", message, alice)
+
+	ts.expect(t, http.StatusOK, "PUT", path, alice.token, nil, &message)
+	reactedBy("alice reacts again", message, alice)
+
+	ts.expect(t, http.StatusOK, "PUT", path, bob.token, nil, &message)
+	reactedBy("bob reacts", message, alice, bob)
+
+	//readReaction - reads the next reaction frame of the user
+	readReaction := func(user testUser) *protocol.ReactionPayload {
+		t.Helper()
+		for {
+			_, payload := readUntil(t, watcher, protocol.TypeReaction)
+			if reaction := payload.(*protocol.ReactionPayload); reaction.UserID == user.id {
+				return reaction
+			}
+		}
+	}
+
+	if reaction := readReaction(bob); reaction.Action != protocol.ReactionAdd || reaction.Count != 2 {
+		t.Fatalf("broadcasted %s of bob with count %d, want %s with count 2", reaction.Action, reaction.Count, protocol.ReactionAdd)
+	}
+
+	ts.expect(t, http.StatusOK, "DELETE", path, bob.token, nil, &message)
+	reactedBy("bob removes the reaction", message, alice)
+
+	if reaction := readReaction(bob); reaction.Action != protocol.ReactionRemove || reaction.Count != 1 {
+		t.Fatalf("broadcasted %s of bob with count %d, want %s with count 1", reaction.Action, reaction.Count, protocol.ReactionRemove)
+	}
+
+	var page struct {
+		Messages []reactions `json:"messages"`
+	}
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID+"/messages", alice.token, nil, &page)
+	if len(page.Messages) != 1 {
+		t.Fatalf("chat room has %d messages, want 1", len(page.Messages))
+	}
+	reactedBy("history", page.Messages[0], alice)
+
+	//only members react
+	ts.expect(t, http.StatusForbidden, "PUT", path, mallory.token, nil, nil)
+}
+
+// TestRedeemInviteLink - invite links join private chat rooms until they are
+// used up, expired or revoked
+func TestRedeemInviteLink(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	carol := ts.newUser(t, "carol")
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	ts.expect(t, http.StatusOK, "POST", "/chat-rooms", alice.token, map[string]string{"name": "private", "visibility": "private"}, &created)
+	roomID := created.ID
+	invites := "/chat-rooms/" + roomID + "/invites"
+
+	var link struct {
+		Code    string `json:"code"`
+		MaxUses int64  `json:"max_uses"`
+		Uses    int64  `json:"uses"`
+	}
+	ts.expect(t, http.StatusBadRequest, "POST", invites, alice.token, map[string]int64{"max_uses": -1}, nil)
+	ts.expect(t, http.StatusBadRequest, "POST", invites, alice.token, map[string]time.Time{"expires_at": time.Now().Add(-time.Minute)}, nil)
+	ts.expect(t, http.StatusForbidden, "POST", invites, bob.token, nil, nil)
+	ts.expect(t, http.StatusOK, "POST", invites, alice.token, map[string]int64{"max_uses": 1}, &link)
+	if link.Code == "" || link.MaxUses != 1 || link.Uses != 0 {
+		t.Fatalf("created invite link %+v, want a code with 1 use left", link)
+	}
+
+	var membership struct {
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	ts.expect(t, http.StatusOK, "POST", "/invites/"+link.Code+"/redeem", bob.token, nil, &membership)
+	if membership.UserID != bob.id || membership.Role != "member" {
+		t.Fatalf("redeeming made user %s a %s, want user %s a member", membership.UserID, membership.Role, bob.id)
+	}
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID, bob.token, nil, nil)
+
+	//redeeming again as a member is harmless, the code is used up for the others
+	ts.expect(t, http.StatusOK, "POST", "/invites/"+link.Code+"/redeem", bob.token, nil, &membership)
+	ts.expect(t, http.StatusGone, "POST", "/invites/"+link.Code+"/redeem", carol.token, nil, nil)
+
+	var active []struct {
+		Code string `json:"code"`
+	}
+	ts.expect(t, http.StatusOK, "GET", invites, alice.token, nil, &active)
+	if len(active) != 0 {
+		t.Fatalf("%d active invite links after the only one was used up, want 0", len(active))
+	}
+
+	ts.expect(t, http.StatusOK, "POST", invites, alice.token, nil, &link)
+	ts.expect(t, http.StatusOK, "DELETE", invites+"/"+link.Code, alice.token, nil, nil)
+	ts.expect(t, http.StatusGone, "POST", "/invites/"+link.Code+"/redeem", carol.token, nil, nil)
+
+	//links can not be created already expired through the api
+	roomObjectID, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		t.Fatalf("parsing room id: %v", err)
+	}
+	expiredAt := time.Now().Add(-time.Minute)
+	expired, err := ts.repository.CreateInviteLink(model.InviteLink{ChatRoomID: roomObjectID, Code: "expired", ExpiresAt: &expiredAt})
+	if err != nil {
+		t.Fatalf("creating expired invite link: %v", err)
+	}
+	ts.expect(t, http.StatusGone, "POST", "/invites/"+expired.Code+"/redeem", carol.token, nil, nil)
+
+	ts.expect(t, http.StatusNotFound, "POST", "/invites/unknown/redeem", carol.token, nil, nil)
+	ts.expect(t, http.StatusForbidden, "GET", "/chat-rooms/"+roomID, carol.token, nil, nil)
+}
+
+// expectForbiddenPost - fails the test unless posting on the websocket is
+// refused because the user is not a member of the chat room
+func expectForbiddenPost(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	if err := sendFrame(conn, protocol.TypeMessage, "forbidden", &protocol.MessagePayload{Body: "let me in"}); err != nil {
+		t.Fatalf("sending message: %v", err)
+	}
+
+	envelope, payload := readUntil(t, conn, protocol.TypeError)
+	if code := payload.(*protocol.ErrorPayload).Code; envelope.ID != "forbidden" || code != protocol.ErrorCodeForbidden {
+		t.Fatalf("error %s for frame %q, want %s for the message", code, envelope.ID, protocol.ErrorCodeForbidden)
+	}
+}
+
+// TestChatRoomRoles - only members post, only the owner and the admins rename
+// and delete the chat room and only the owner changes roles
+func TestChatRoomRoles(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	carol := ts.newUser(t, "carol")
+	mallory := ts.newUser(t, "mallory")
+	roomID := ts.newRoom(t, alice, "room")
+	room := "/chat-rooms/" + roomID
+	rename := map[string]string{"name": "renamed"}
+
+	ts.expect(t, http.StatusOK, "POST", room+"/members", bob.token, nil, nil)
+	ts.expect(t, http.StatusOK, "POST", room+"/members", carol.token, nil, nil)
+
+	//watching a public chat room does not allow to post in it
+	expectForbiddenPost(t, ts.dial(t, mallory, roomID, ""))
+
+	//members neither manage the chat room nor change roles
+	ts.expect(t, http.StatusForbidden, "PUT", room, bob.token, rename, nil)
+	ts.expect(t, http.StatusForbidden, "DELETE", room, bob.token, nil, nil)
+	ts.expect(t, http.StatusForbidden, "PUT", room+"/members/"+carol.id, bob.token, map[string]string{"role": "admin"}, nil)
+
+	//the owner makes an admin, that manages the chat room but not the roles
+	var membership struct {
+		Role string `json:"role"`
+	}
+	ts.expect(t, http.StatusOK, "PUT", room+"/members/"+carol.id, alice.token, map[string]string{"role": "admin"}, &membership)
+	if membership.Role != "admin" {
+		t.Fatalf("carol is %s, want admin", membership.Role)
+	}
+	ts.expect(t, http.StatusOK, "PUT", room, carol.token, rename, nil)
+	ts.expect(t, http.StatusForbidden, "PUT", room+"/members/"+bob.id, carol.token, map[string]string{"role": "admin"}, nil)
+
+	//there is a single owner
+	ts.expect(t, http.StatusBadRequest, "PUT", room+"/members/"+carol.id, alice.token, map[string]string{"role": "owner"}, nil)
+	ts.expect(t, http.StatusBadRequest, "PUT", room+"/members/"+alice.id, alice.token, map[string]string{"role": "member"}, nil)
+
+	//an admin made a member again loses the rights
+	ts.expect(t, http.StatusOK, "PUT", room+"/members/"+carol.id, alice.token, map[string]string{"role": "member"}, nil)
+	ts.expect(t, http.StatusForbidden, "DELETE", room, carol.token, nil, nil)
+
+	ts.expect(t, http.StatusOK, "PUT", room+"/members/"+carol.id, alice.token, map[string]string{"role": "admin"}, nil)
+	ts.expect(t, http.StatusOK, "DELETE", room, carol.token, nil, nil)
+}
+
+// TestChatRoomWithoutOwner - chat rooms created before memberships can not be
+// managed nor posted in without joining them
+func TestChatRoomWithoutOwner(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+
+	id, err := ts.repository.CreateChatRoom(model.ChatRoom{Name: "legacy"})
+	if err != nil {
+		t.Fatalf("creating chat room: %v", err)
+	}
+	room := "/chat-rooms/" + id.Hex()
+
+	ts.expect(t, http.StatusForbidden, "PUT", room, alice.token, map[string]string{"name": "mine"}, nil)
+	ts.expect(t, http.StatusForbidden, "DELETE", room, alice.token, nil, nil)
+	ts.expect(t, http.StatusForbidden, "POST", room+"/invites", alice.token, nil, nil)
+
+	conn := ts.dial(t, alice, id.Hex(), "")
+	expectForbiddenPost(t, conn)
+
+	ts.expect(t, http.StatusOK, "POST", room+"/members", alice.token, nil, nil)
+	if ack := postMessage(t, conn, "c1", "joined"); ack.Seq != 1 {
+		t.Fatalf("message of the new member has seq %d, want 1", ack.Seq)
+	}
+}
+
+// failingMembers - repository failing to add members
+type failingMembers struct {
+	repository.Repository
+}
+
+// AddMember - always fails
+func (failingMembers) AddMember(membership model.Membership) (model.Membership, error) {
+	return membership, errors.New("memberships are unavailable")
+}
+
+// TestCreateChatRoomWithoutOwnerRolledBack - a chat room whose owner can not
+// be added is not left behind
+func TestCreateChatRoomWithoutOwnerRolledBack(t *testing.T) {
+
+	ts := newTestServerWith(t, failingMembers{repository.NewMemoryRepository()})
+	alice := ts.newUser(t, "alice")
+
+	ts.expect(t, http.StatusInternalServerError, "POST", "/chat-rooms", alice.token, map[string]string{"name": "room"}, nil)
+
+	count, err := ts.repository.CountChatRoomByChatName("room")
+	if err != nil {
+		t.Fatalf("counting chat rooms: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("%d chat rooms left behind, want 0", count)
+	}
+}
+
+// countingUsers - repository counting the user lookups
+type countingUsers struct {
+	repository.Repository
+	byID  int64
+	byIDs int64
+}
+
+func (repo *countingUsers) FindUserByID(id primitive.ObjectID) (model.User, error) {
+	atomic.AddInt64(&repo.byID, 1)
+	return repo.Repository.FindUserByID(id)
+}
+
+func (repo *countingUsers) FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error) {
+	atomic.AddInt64(&repo.byIDs, 1)
+	return repo.Repository.FindUsersByIDs(ids)
+}
+
+func TestGetChatRoomOnline(t *testing.T) {
+
+	repo := &countingUsers{Repository: repository.NewMemoryRepository()}
+	ts := newTestServerWith(t, repo)
+	alice := ts.newUser(t, "alice")
+	roomID := ts.newRoom(t, alice, "room")
+
+	users := []testUser{alice}
+	for i := 0; i < 4; i++ {
+		users = append(users, ts.newUser(t, fmt.Sprintf("user%d", i)))
+	}
+	for _, user := range users {
+		ts.dial(t, user, roomID, "")
+	}
+	//a second tab is listed once
+	ts.dial(t, alice, roomID, "")
+	ts.waitClients(t, len(users)+1)
+
+	atomic.StoreInt64(&repo.byID, 0)
+	atomic.StoreInt64(&repo.byIDs, 0)
+
+	var online struct {
+		Users []struct {
+			ID string `json:"_id"`
+		} `json:"users"`
+	}
+	ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+roomID+"/online", alice.token, nil, &online)
+
+	if len(online.Users) != len(users) {
+		t.Fatalf("got %d online users, want %d", len(online.Users), len(users))
+	}
+	for i := 1; i < len(online.Users); i++ {
+		if online.Users[i-1].ID >= online.Users[i].ID {
+			t.Fatalf("online users are not sorted by id: %+v", online.Users)
+		}
+	}
+
+	//only the bearer token is looked up by id
+	if byID, byIDs := atomic.LoadInt64(&repo.byID), atomic.LoadInt64(&repo.byIDs); byID != 1 || byIDs != 1 {
+		t.Fatalf("looked users up %d times by id and %d times by ids, want 1 and 1", byID, byIDs)
+	}
+}
+
+func TestLogin(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+
+	//the token identifies the user it was issued to
+	var user struct {
+		ID       string `json:"_id"`
+		UserName string `json:"username"`
+		Password string `json:"password"`
+	}
+	ts.expect(t, http.StatusOK, "GET", "/users/"+alice.id, alice.token, nil, &user)
+	if user.ID != alice.id || user.UserName != "alice" || user.Password != "" {
+		t.Fatalf("got user %+v, want alice without the password hash", user)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{name: "wrong password", username: "alice", password: "wrong"},
+		{name: "unknown user", username: "nobody", password: "password"},
+		{name: "empty credentials", username: "", password: ""},
+	}
+
+	for _, test := range tests {
+		var login struct {
+			Token string `json:"token"`
+		}
+		credentials := map[string]string{"username": test.username, "password": test.password}
+		if status := ts.call(t, "POST", "/auth/login", "", credentials, &login); status != http.StatusUnauthorized || login.Token != "" {
+			t.Errorf("%s: status %d with token %q, want %d without token", test.name, status, login.Token, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	roomID := ts.newRoom(t, alice, "general")
+
+	expired, _, err := auth.NewTokens(ts.config.AuthSecret, -time.Minute).NewToken(alice.id, "alice")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+	forged, _, err := auth.NewTokens("other-secret", time.Hour).NewToken(alice.id, "alice")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+	unknownUser, _, err := auth.NewTokens(ts.config.AuthSecret, time.Hour).NewToken(primitive.NewObjectID().Hex(), "ghost")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "valid token", header: "Bearer " + alice.token, want: http.StatusOK},
+		{name: "no header", header: "", want: http.StatusUnauthorized},
+		{name: "other scheme", header: "Basic " + alice.token, want: http.StatusUnauthorized},
+		{name: "malformed token", header: "Bearer not-a-token", want: http.StatusUnauthorized},
+		{name: "expired token", header: "Bearer " + expired, want: http.StatusUnauthorized},
+		{name: "other secret", header: "Bearer " + forged, want: http.StatusUnauthorized},
+		{name: "unknown user", header: "Bearer " + unknownUser, want: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		for _, path := range []string{"/chat-rooms", "/chat-rooms/" + roomID, "/users/" + alice.id} {
+			req, err := http.NewRequest("GET", ts.URL+ts.config.BasePath+path, nil)
+			if err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+			if test.header != "" {
+				req.Header.Set("Authorization", test.header)
+			}
+
+			res, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != test.want {
+				t.Errorf("%s: GET %s: status %d, want %d", test.name, path, res.StatusCode, test.want)
+			}
+		}
+
+		//the websocket authenticates the same tokens
+		if test.header == "" || !strings.HasPrefix(test.header, "Bearer ") {
+			continue
+		}
+		conn, status, err := ts.connect(testUser{token: strings.TrimPrefix(test.header, "Bearer ")}, roomID, "")
+		if test.want == http.StatusOK {
+			if err != nil {
+				t.Errorf("%s: websocket: %v (status %d)", test.name, err, status)
+				continue
+			}
+			conn.Close()
+		} else if status != test.want {
+			t.Errorf("%s: websocket status %d, want %d", test.name, status, test.want)
+		}
+	}
+
+	//public apis need no token
+	ts.expect(t, http.StatusOK, "GET", "/", "", nil, nil)
+}
+
+func TestFrameForAnotherRoom(t *testing.T) {
+
+	ts := newTestServer(t)
+	alice := ts.newUser(t, "alice")
+	roomID := ts.newRoom(t, alice, "room")
+	otherID := ts.newRoom(t, alice, "other")
+
+	conn := ts.dial(t, alice, roomID, "")
+
+	envelope, err := protocol.NewEnvelope(protocol.TypeMessage, "elsewhere", otherID, &protocol.MessagePayload{Body: "wrong room"})
+	if err != nil {
+		t.Fatalf("building frame: %v", err)
+	}
+	if err := conn.WriteJSON(envelope); err != nil {
+		t.Fatalf("sending frame: %v", err)
+	}
+
+	reply, payload := readUntil(t, conn, protocol.TypeError)
+	if code := payload.(*protocol.ErrorPayload).Code; reply.ID != "elsewhere" || code != protocol.ErrorCodeRoomMismatch {
+		t.Fatalf("error %s for frame %q, want %s for the message", code, reply.ID, protocol.ErrorCodeRoomMismatch)
+	}
+
+	//the connection stays open and frames naming its room are accepted
+	envelope, err = protocol.NewEnvelope(protocol.TypeMessage, "here", roomID, &protocol.MessagePayload{Body: "right room"})
+	if err != nil {
+		t.Fatalf("building frame: %v", err)
+	}
+	if err := conn.WriteJSON(envelope); err != nil {
+		t.Fatalf("sending frame: %v", err)
+	}
+	if _, payload := readUntil(t, conn, protocol.TypeAck); payload.(*protocol.AckPayload).Seq != 1 {
+		t.Fatalf("got ack %+v, want the first message of the room", payload)
+	}
+
+	for _, id := range []string{roomID, otherID} {
+		var page struct {
+			Messages []model.Message `json:"messages"`
+		}
+		ts.expect(t, http.StatusOK, "GET", "/chat-rooms/"+id+"/messages", alice.token, nil, &page)
+		if want := map[string]int{roomID: 1, otherID: 0}[id]; len(page.Messages) != want {
+			t.Fatalf("room %s has %d messages, want %d", id, len(page.Messages), want)
+		}
+	}
+}
+
+// sendTyping - sends a typing frame with the status
+func sendTyping(t *testing.T, conn *websocket.Conn, status string) {
+	t.Helper()
+
+	if err := sendFrame(conn, protocol.TypeTyping, "", &protocol.TypingPayload{Status: status}); err != nil {
+		t.Fatalf("sending typing %s: %v", status, err)
+	}
+}
+
+// expectTyping - reads the next typing frame, failing the test unless it has
+// the user and status
+func expectTyping(t *testing.T, conn *websocket.Conn, user testUser, status string) {
+	t.Helper()
+
+	_, payload := readUntil(t, conn, protocol.TypeTyping)
+	if typing := payload.(*protocol.TypingPayload); typing.UserID != user.id || typing.Status != status {
+		t.Fatalf("got typing %s of %s, want %s of %s", typing.Status, typing.UserID, status, user.id)
+	}
+}
+
+func TestTypingThrottled(t *testing.T) {
+
+	cfg := testConfig()
+	cfg.TypingThrottle = time.Minute
+	cfg.TypingTimeout = time.Minute
+
+	ts := newTestServerFrom(t, cfg, repository.NewMemoryRepository())
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	roomID := ts.newRoom(t, alice, "room")
+
+	typist := ts.dial(t, alice, roomID, "")
+	watcher := ts.dial(t, bob, roomID, "")
+	ts.waitClients(t, 2)
+
+	//starts within the throttle are broadcast once, the next typing frame
+	//is the stop
+	for i := 0; i < 5; i++ {
+		sendTyping(t, typist, protocol.TypingStart)
+	}
+	sendTyping(t, typist, protocol.TypingStop)
+
+	expectTyping(t, watcher, alice, protocol.TypingStart)
+	expectTyping(t, watcher, alice, protocol.TypingStop)
+
+	//a stop resets the throttle
+	sendTyping(t, typist, protocol.TypingStart)
+	expectTyping(t, watcher, alice, protocol.TypingStart)
+}
+
+func TestTypingExpires(t *testing.T) {
+
+	cfg := testConfig()
+	cfg.TypingTimeout = 100 * time.Millisecond
+
+	ts := newTestServerFrom(t, cfg, repository.NewMemoryRepository())
+	alice := ts.newUser(t, "alice")
+	bob := ts.newUser(t, "bob")
+	roomID := ts.newRoom(t, alice, "room")
+
+	typist := ts.dial(t, alice, roomID, "")
+	watcher := ts.dial(t, bob, roomID, "")
+	ts.waitClients(t, 2)
+
+	start := time.Now()
+	sendTyping(t, typist, protocol.TypingStart)
+	expectTyping(t, watcher, alice, protocol.TypingStart)
+
+	//the typist went idle without sending stop
+	expectTyping(t, watcher, alice, protocol.TypingStop)
+	if elapsed := time.Since(start); elapsed < cfg.TypingTimeout {
+		t.Fatalf("typing stopped after %s, want at least %s", elapsed, cfg.TypingTimeout)
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken - token is malformed or its signature does not match
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrExpiredToken - token signature is valid but it is past its expiry
+var ErrExpiredToken = errors.New("token expired")
+
+// ErrNoSecret - no secret is configured so tokens can not be signed
+var ErrNoSecret = errors.New("AUTH_SECRET is not set")
+
+// Claims - content of a token
+type Claims struct {
+	UserID    string `json:"sub"`
+	UserName  string `json:"username"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Tokens - issues and verifies signed bearer tokens
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokens - returns tokens signed with secret and expiring after ttl
+func NewTokens(secret string, ttl time.Duration) *Tokens {
+	return &Tokens{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// NewToken - issues a signed token for the user
+func (tokens *Tokens) NewToken(userID string, username string) (string, Claims, error) {
+
+	if len(tokens.secret) == 0 {
+		return "", Claims{}, ErrNoSecret
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		UserName:  username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(tokens.ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", claims, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + tokens.sign(encoded), claims, nil
+}
+
+// ParseToken - verifies the signature and expiry of the token and returns its claims
+func (tokens *Tokens) ParseToken(token string) (Claims, error) {
+
+	var claims Claims
+
+	if len(tokens.secret) == 0 {
+		return claims, ErrNoSecret
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, ErrInvalidToken
+	}
+
+	//constant time comparison of the signature
+	if !hmac.Equal([]byte(parts[1]), []byte(tokens.sign(parts[0]))) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+// sign - HMAC-SHA256 signature of the encoded payload
+func (tokens *Tokens) sign(encoded string) string {
+
+	mac := hmac.New(sha256.New, tokens.secret)
+	mac.Write([]byte(encoded))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseToken(t *testing.T) {
+
+	tokens := NewTokens("secret", time.Hour)
+
+	token, issued, err := tokens.NewToken("user-id", "alice")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+
+	claims, err := tokens.ParseToken(token)
+	if err != nil {
+		t.Fatalf("parsing token: %v", err)
+	}
+	if claims != issued || claims.UserID != "user-id" || claims.UserName != "alice" {
+		t.Fatalf("claims %+v, want %+v", claims, issued)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != int64(time.Hour/time.Second) {
+		t.Fatalf("token issued at %d expires at %d, want an hour later", claims.IssuedAt, claims.ExpiresAt)
+	}
+}
+
+func TestParseInvalidToken(t *testing.T) {
+
+	tokens := NewTokens("secret", time.Hour)
+
+	token, _, err := tokens.NewToken("user-id", "alice")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	//a payload granting another user, signed with another secret
+	forged, _, err := NewTokens("other-secret", time.Hour).NewToken("admin-id", "admin")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+	forgedPayload := strings.Split(forged, ".")[0]
+
+	//correctly signed payloads that are not claims
+	notBase64 := "not base64!"
+	notJSON := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "no signature", token: parts[0]},
+		{name: "extra part", token: token + ".extra"},
+		{name: "other secret", token: forged},
+		{name: "tampered payload", token: forgedPayload + "." + parts[1]},
+		{name: "tampered signature", token: parts[0] + "." + parts[1][1:]},
+		{name: "payload not base64", token: notBase64 + "." + tokens.sign(notBase64)},
+		{name: "payload not json", token: notJSON + "." + tokens.sign(notJSON)},
+	}
+
+	for _, test := range tests {
+		if _, err := tokens.ParseToken(test.token); err != ErrInvalidToken {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestParseExpiredToken(t *testing.T) {
+
+	token, _, err := NewTokens("secret", -time.Minute).NewToken("user-id", "alice")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+
+	//the expiry is checked by whoever parses it
+	claims, err := NewTokens("secret", time.Hour).ParseToken(token)
+	if err != ErrExpiredToken {
+		t.Fatalf("got %v, want %v", err, ErrExpiredToken)
+	}
+	if claims.UserID != "user-id" {
+		t.Fatalf("claims of an expired token %+v, want the user", claims)
+	}
+}
+
+func TestTokensWithoutSecret(t *testing.T) {
+
+	tokens := NewTokens("", time.Hour)
+
+	if _, _, err := tokens.NewToken("user-id", "alice"); err != ErrNoSecret {
+		t.Fatalf("issuing token: got %v, want %v", err, ErrNoSecret)
+	}
+
+	//a token signed with an empty key must not be accepted either
+	token, _, err := NewTokens("secret", time.Hour).NewToken("user-id", "alice")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+	if _, err := tokens.ParseToken(token); err != ErrNoSecret {
+		t.Fatalf("parsing token: got %v, want %v", err, ErrNoSecret)
+	}
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultBasePath - base path of the apis when SVR_BASEPATH is not set
+const defaultBasePath = "/realtime-chat/api/v1"
+
+// defaultDBDriver - scheme of the mongodb uri when DB_DRIVER is not set
+const defaultDBDriver = "mongodb"
+
+// defaultRepository - repository used when REPOSITORY is not set
+const defaultRepository = "mongodb"
+
+// defaultTokenTTL - token lifetime when AUTH_TOKEN_TTL is not set
+const defaultTokenTTL = 24 * time.Hour
+
+// default websocket heartbeat settings
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultPongWait     = 60 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// default typing indicator settings
+const (
+	defaultTypingThrottle = 3 * time.Second
+	defaultTypingTimeout  = 10 * time.Second
+)
+
+// default websocket send queue settings
+const (
+	defaultSendQueueSize   = 256
+	defaultOverflowPolicy  = "disconnect"
+	defaultOverflowTimeout = 100 * time.Millisecond
+)
+
+// Config - settings of the service
+type Config struct {
+	// address the server listens on, e.g. ":8081"
+	Port string
+	// path prefix of every api
+	BasePath string
+	// "mongodb" or "memory", where the chat data is kept
+	Repository string
+	// scheme of the mongodb uri, e.g. "mongodb" or "mongodb+srv"
+	DBDriver string
+	// host and port of mongodb, the port is left out of the uri when empty
+	DBHost string
+	DBPort string
+	// database the mongodb user is authenticated against
+	DBName string
+	// credentials of the mongodb user
+	DBUser     string
+	DBPassword string
+	// key used to sign the bearer tokens
+	AuthSecret string
+	// lifetime of the bearer tokens
+	TokenTTL time.Duration
+	// interval between two websocket pings
+	PingInterval time.Duration
+	// websocket clients that did not answer a ping for this long are closed,
+	// at least twice PingInterval when not longer than it
+	PongWait time.Duration
+	// time allowed to write a websocket message
+	WriteTimeout time.Duration
+	// number of outbound messages queued per websocket client
+	SendQueueSize int
+	// "drop_oldest", "disconnect" or "block" when the queue of a client is full
+	OverflowPolicy string
+	// longest wait for room in a full queue with the "block" policy
+	OverflowTimeout time.Duration
+	// minimum time between two typing starts broadcast for a connection
+	TypingThrottle time.Duration
+	// typing stops when no start is received for this long
+	TypingTimeout time.Duration
+}
+
+// Load - reads the config from the environment variables, see conf/export.sh
+func Load() Config {
+
+	cfg := Config{
+		Port:            os.Getenv("SVR_PORT"),
+		BasePath:        os.Getenv("SVR_BASEPATH"),
+		Repository:      os.Getenv("REPOSITORY"),
+		DBDriver:        os.Getenv("DB_DRIVER"),
+		DBHost:          os.Getenv("DB_HOST"),
+		DBPort:          os.Getenv("DB_PORT"),
+		DBName:          os.Getenv("DB_NAME"),
+		DBUser:          os.Getenv("DB_USER"),
+		DBPassword:      os.Getenv("DB_PASSWORD"),
+		AuthSecret:      os.Getenv("AUTH_SECRET"),
+		TokenTTL:        duration("AUTH_TOKEN_TTL", defaultTokenTTL),
+		PingInterval:    duration("WS_PING_INTERVAL", defaultPingInterval),
+		PongWait:        duration("WS_PONG_WAIT", defaultPongWait),
+		WriteTimeout:    duration("WS_WRITE_TIMEOUT", defaultWriteTimeout),
+		SendQueueSize:   defaultSendQueueSize,
+		OverflowPolicy:  os.Getenv("WS_OVERFLOW_POLICY"),
+		OverflowTimeout: duration("WS_OVERFLOW_TIMEOUT", defaultOverflowTimeout),
+		TypingThrottle:  duration("WS_TYPING_THROTTLE", defaultTypingThrottle),
+		TypingTimeout:   duration("WS_TYPING_TIMEOUT", defaultTypingTimeout),
+	}
+
+	if cfg.BasePath == "" {
+		cfg.BasePath = defaultBasePath
+	}
+
+	if cfg.Repository == "" {
+		cfg.Repository = defaultRepository
+	}
+
+	if cfg.DBDriver == "" {
+		cfg.DBDriver = defaultDBDriver
+	}
+
+	//a pong can only arrive after a ping, clients would be reaped before
+	//answering the first one if the pong wait was not longer than the interval
+	if cfg.PongWait <= cfg.PingInterval {
+		cfg.PongWait = 2 * cfg.PingInterval
+	}
+
+	if size, err := strconv.Atoi(os.Getenv("WS_SEND_QUEUE_SIZE")); err == nil && size > 0 {
+		cfg.SendQueueSize = size
+	}
+
+	switch cfg.OverflowPolicy {
+	case "drop_oldest", "disconnect", "block":
+	default:
+		cfg.OverflowPolicy = defaultOverflowPolicy
+	}
+
+	return cfg
+}
+
+// duration - reads a duration such as "30s" from the environment variable,
+// returning fallback when it is not set or invalid
+func duration(name string, fallback time.Duration) time.Duration {
+
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// setenv - sets the environment variable for the duration of the test
+func setenv(t *testing.T, name string, value string) {
+	old, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestLoadPongWaitLongerThanPingInterval(t *testing.T) {
+
+	tests := []struct {
+		pingInterval string
+		pongWait     string
+		want         time.Duration
+	}{
+		{pingInterval: "30s", pongWait: "60s", want: 60 * time.Second},
+		{pingInterval: "90s", pongWait: "", want: 180 * time.Second},
+		{pingInterval: "30s", pongWait: "30s", want: 60 * time.Second},
+		{pingInterval: "30s", pongWait: "31s", want: 31 * time.Second},
+	}
+
+	for _, test := range tests {
+		setenv(t, "WS_PING_INTERVAL", test.pingInterval)
+		setenv(t, "WS_PONG_WAIT", test.pongWait)
+
+		cfg := Load()
+		if cfg.PongWait != test.want {
+			t.Errorf("WS_PING_INTERVAL=%s WS_PONG_WAIT=%s: PongWait = %s, want %s", test.pingInterval, test.pongWait, cfg.PongWait, test.want)
+		}
+	}
+}
+
+func TestLoadRepositoryAndDBDriver(t *testing.T) {
+
+	tests := []struct {
+		repository     string
+		dbDriver       string
+		wantRepository string
+		wantDBDriver   string
+	}{
+		{repository: "", dbDriver: "", wantRepository: "mongodb", wantDBDriver: "mongodb"},
+		{repository: "", dbDriver: "mongodb+srv", wantRepository: "mongodb", wantDBDriver: "mongodb+srv"},
+		{repository: "memory", dbDriver: "mongodb", wantRepository: "memory", wantDBDriver: "mongodb"},
+	}
+
+	for _, test := range tests {
+		setenv(t, "REPOSITORY", test.repository)
+		setenv(t, "DB_DRIVER", test.dbDriver)
+
+		cfg := Load()
+		if cfg.Repository != test.wantRepository || cfg.DBDriver != test.wantDBDriver {
+			t.Errorf("REPOSITORY=%s DB_DRIVER=%s: Repository = %s, DBDriver = %s, want %s and %s", test.repository, test.dbDriver, cfg.Repository, cfg.DBDriver, test.wantRepository, test.wantDBDriver)
+		}
+	}
+}
@@ -2,43 +2,28 @@ package database
 
 import (
 	"context"
-	"github.com/rs/zerolog/log"
-	"os"
+	"github.com/Tainzen/realtime-chat/utils/config"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-//Db setup connection with mongodb and returns mongo client
-func Db() *mongo.Client {
+// Connect - sets up the connection with the mongodb of the config and returns the mongo client
+func Connect(cfg config.Config) (*mongo.Client, error) {
 
-	dbDriver := os.Getenv("DB_DRIVER")
-	dbUser := os.Getenv("DB_USER")
-	dbPass := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dburl := dbHost + ":" + dbPort
+	//mongodb+srv uris look the port up and must not have one
+	dburl := cfg.DBHost
+	if cfg.DBPort != "" {
+		dburl += ":" + cfg.DBPort
+	}
 
 	//setting credentials for mongodb user
 	credential := options.Credential{
-		AuthSource: dbName,
-		Username:   dbUser,
-		Password:   dbPass,
-	}
-
-	clientOptions := options.Client().ApplyURI(dbDriver + "://" + dburl + "/").SetAuth(credential)
-
-	client, err := mongo.Connect(context.Background(), clientOptions)
-	if err != nil {
-		log.Panic().Msgf("Error connecting to mongodb")
+		AuthSource: cfg.DBName,
+		Username:   cfg.DBUser,
+		Password:   cfg.DBPassword,
 	}
 
-	// // Check the connection to MongoDB
-	// err = client.Ping(context.TODO(), nil)
-	// if err != nil {
-	// 	log.Panic().Msgf("Error while pinging to mongodb")
-	// }
+	clientOptions := options.Client().ApplyURI(cfg.DBDriver + "://" + dburl + "/").SetAuth(credential)
 
-	log.Info().Msgf("Successfully established connection to mongodb")
-	return client
+	return mongo.Connect(context.Background(), clientOptions)
 }